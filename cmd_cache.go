@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mkideal/mnist/dataset"
+)
+
+func cacheUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cache [flags] list|verify|clean [dataset...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+}
+
+func cacheCommand(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	flCacheDir := fs.String("cache", "", "cache directory (default $"+dataset.CacheDirEnv+" or user cache directory)")
+	fs.Usage = cacheUsage(fs)
+	fs.Parse(args)
+
+	d := &dataset.Downloader{CacheDir: *flCacheDir}
+	switch fs.Arg(0) {
+	case "list":
+		entries, err := d.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "DATASET\tSIZE\tFILE")
+		var total int64
+		for _, entry := range entries {
+			name := entry.Dataset
+			if name == "" {
+				name = "-"
+			}
+			if entry.Partial {
+				name += " (partial)"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", name, entry.Size, entry.Filename)
+			total += entry.Size
+		}
+		fmt.Fprintf(w, "total\t%d\t%s\n", total, d.Dir())
+		return w.Flush()
+	case "verify":
+		entries, err := d.List()
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, entry := range entries {
+			if entry.Partial {
+				continue
+			}
+			status := "ok"
+			if err := entry.Verify(); errors.Is(err, dataset.ErrUnknownChecksum) {
+				status = "unknown"
+			} else if err != nil {
+				status = "FAILED: " + err.Error()
+				failed++
+			}
+			fmt.Printf("%s: %s\n", entry.Filename, status)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d cached files failed verification", failed)
+		}
+		return nil
+	case "clean":
+		return d.Clean(fs.Args()[1:]...)
+	}
+	fs.Usage()
+	return errFlags
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/dataset/idx"
+	"github.com/mkideal/mnist/mathx"
+)
+
+func convertCommand(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	flDataset := fs.String("dataset", dataset.MNIST.Name, "dataset which decides the IDX image format and number of classes")
+	flImages := fs.String("images", "", "IDX images file")
+	flLabels := fs.String("labels", "", "IDX labels file, optional")
+	flCSV := fs.String("csv", "", "CSV file in Kaggle format: label,pixel0,...")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s convert [flags] idx2csv|csv2idx\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Files ending with .gz are gzip compressed, IDX files are written in the layout of -dataset.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *flImages == "" || *flCSV == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errFlags
+	}
+	info, ok := dataset.Lookup(*flDataset)
+	if !ok {
+		return usagef("unknown dataset %q, available datasets: %s", *flDataset, strings.Join(dataset.Names(), ", "))
+	}
+
+	ctx := context.Background()
+	switch fs.Arg(0) {
+	case "idx2csv":
+		return idxToCSV(ctx, info, *flImages, *flLabels, *flCSV)
+	case "csv2idx":
+		return csvToIDX(ctx, info, *flCSV, *flImages, *flLabels)
+	}
+	fs.Usage()
+	return errFlags
+}
+
+func idxToCSV(ctx context.Context, info *dataset.Info, imageFile, labelFile, csvFile string) error {
+	file, err := os.Open(imageFile)
+	if err != nil {
+		return err
+	}
+	inputs, err := info.ReadImages(ctx, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	var labels []*mathx.Matrix
+	if labelFile != "" {
+		file, err := os.Open(labelFile)
+		if err != nil {
+			return err
+		}
+		labels, err = info.ReadLabels(ctx, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if len(labels) != len(inputs) {
+			return fmt.Errorf("%w: %d images, %d labels", dataset.ErrCountMismatch, len(inputs), len(labels))
+		}
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("%s: no images", imageFile)
+	}
+
+	return idx.CreateFile(csvFile, func(w io.Writer) error {
+		cw := dataset.NewCSVWriter(w, inputs[0].RowCount(), labels != nil)
+		for i, input := range inputs {
+			label := -1
+			if labels != nil {
+				label, _, _ = labels[i].MaxElem()
+			}
+			if err := cw.Write(input, label); err != nil {
+				return err
+			}
+		}
+		return cw.Flush()
+	})
+}
+
+func csvToIDX(ctx context.Context, info *dataset.Info, csvFile, imageFile, labelFile string) error {
+	file, err := os.Open(csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := dataset.NewCSVReader(file, info.NumClasses)
+	if err != nil {
+		return fmt.Errorf("%s: %w", csvFile, err)
+	}
+	defer r.Close()
+	side := int(math.Sqrt(float64(r.ImageSize())))
+	if side*side != r.ImageSize() {
+		return fmt.Errorf("%s: %w: %d pixels is not a square image", csvFile, dataset.ErrShape, r.ImageSize())
+	}
+	if labelFile != "" && !r.Labeled() {
+		return fmt.Errorf("%s: CSV has no label column", csvFile)
+	}
+
+	var images, labels []uint8
+	pixels := make([]uint8, r.ImageSize())
+	for ctx.Err() == nil {
+		label, err := r.Read(pixels)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", csvFile, err)
+		}
+		if info.Transposed {
+			// stored column by column, CSV images are row by row
+			image := make([]uint8, len(pixels))
+			for j, b := range pixels {
+				image[j%side*side+j/side] = b
+			}
+			images = append(images, image...)
+		} else {
+			images = append(images, pixels...)
+		}
+		labels = append(labels, uint8(label+info.LabelOffset))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n := len(labels)
+	if err := idx.WriteFile(imageFile, &idx.Tensor{Type: idx.Uint8, Dims: []int{n, side, side}, Data: images}); err != nil {
+		return err
+	}
+	if labelFile != "" {
+		return idx.WriteFile(labelFile, &idx.Tensor{Type: idx.Uint8, Dims: []int{n}, Data: labels})
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+)
+
+func inspectCommand(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flDataset := fs.String("dataset", dataset.MNIST.Name, "dataset name")
+	flDatasetPath := fs.String("d", "", "dataset path or remote root URL (default URL of the dataset)")
+	flCacheDir := fs.String("cache", "", "cache directory of downloaded files (default $"+dataset.CacheDirEnv+" or user cache directory)")
+	flOffline := fs.Bool("offline", false, "don't download, fail if dataset files are not cached")
+	flBinaryCache := fs.Bool("bincache", true, "cache decoded datasets as binary files which are memory-mapped by later runs")
+	flTest := fs.Bool("test", false, "inspect test set instead of training set")
+	flCSV := fs.String("csv", "", "inspect a labeled CSV file instead of the dataset files")
+	flOutput := fs.String("o", "", "write mean and std images and the mean image of each class as PNG files to the directory")
+	flScore := fs.Float64("z", dataset.DefaultOutlierScore, "z-score of distance to class mean above which a sample is an outlier")
+	flLimit := fs.Int("n", 20, "max number of listed duplicates and outliers")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	info, ok := dataset.Lookup(*flDataset)
+	if !ok {
+		return usagef("unknown dataset %q, available datasets: %s", *flDataset, strings.Join(dataset.Names(), ", "))
+	}
+	defer useCache(*flCacheDir, *flOffline, *flBinaryCache)()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var d *dataset.Dataset
+	var err error
+	if *flCSV != "" {
+		file, err := os.Open(*flCSV)
+		if err != nil {
+			return err
+		}
+		d, err = dataset.ReadCSVDataset(ctx, file, info.NumClasses)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *flCSV, err)
+		}
+	} else {
+		root := *flDatasetPath
+		if root == "" {
+			if root = info.URL; root == "" {
+				return usagef("dataset %s can't be downloaded, please specify its local path by -d", info.Name)
+			}
+		}
+		if *flTest {
+			d, err = info.LoadTestSet(ctx, root)
+		} else {
+			d, err = info.LoadTrainingSet(ctx, root)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	stats := dataset.ComputeStats(d, mathx.Float(*flScore))
+	stats.Report(os.Stdout, info.ClassNames, *flLimit)
+	if *flOutput != "" {
+		return writeStatsImages(*flOutput, stats)
+	}
+	return nil
+}
+
+// writeStatsImages writes mean.png, std.png, class_<label>.png and classes.png to dir
+func writeStatsImages(dir string, stats *dataset.Stats) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := dataset.WritePNG(filepath.Join(dir, "mean.png"), stats.Mean.Gray()); err != nil {
+		return err
+	}
+	// scale std to full range
+	std := dataset.NewImage(stats.Rows, stats.Cols)
+	var max mathx.Float
+	for _, x := range stats.Std.Pix {
+		if x > max {
+			max = x
+		}
+	}
+	if max > 0 {
+		for j, x := range stats.Std.Pix {
+			std.Pix[j] = x / max
+		}
+	}
+	if err := dataset.WritePNG(filepath.Join(dir, "std.png"), std.Gray()); err != nil {
+		return err
+	}
+	var means []*dataset.Image
+	for label, img := range stats.ClassMeans {
+		if img == nil {
+			img = dataset.NewImage(stats.Rows, stats.Cols)
+		}
+		means = append(means, img)
+		if err := dataset.WritePNG(filepath.Join(dir, fmt.Sprintf("class_%d.png", label)), img.Gray()); err != nil {
+			return err
+		}
+	}
+	return dataset.WritePNG(filepath.Join(dir, "classes.png"), dataset.Grid(means, 10))
+}
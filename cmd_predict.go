@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/mkideal/mnist/nn"
+)
+
+func predictCommand(args []string) error {
+	fs := flag.NewFlagSet("predict", flag.ExitOnError)
+	flModel := fs.String("m", "", "model file saved by training with -o")
+	flDataset := fs.String("dataset", dataset.MNIST.Name, "dataset which decides the image format and class names")
+	flImages := fs.String("images", "", "IDX images file or directory of PNG/JPEG/GIF images with a subdirectory per class")
+	flLabels := fs.String("labels", "", "IDX labels file, accuracy is reported if specified")
+	flInvert := fs.String("invert", "auto", "invert PNG/JPEG/GIF images: auto, never or always")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s predict -m model -images file [-labels file]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s predict -m model [-images dir] [image.png...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *flModel == "" || (*flImages == "" && fs.NArg() == 0) {
+		fs.Usage()
+		return errFlags
+	}
+	if *flLabels != "" && *flImages != "" {
+		if stat, err := os.Stat(*flImages); err == nil && stat.IsDir() {
+			return usagef("-labels can not be used with an image directory, its subdirectories are the labels")
+		}
+	}
+
+	info, ok := dataset.Lookup(*flDataset)
+	if !ok {
+		return usagef("unknown dataset %q, available datasets: %s", *flDataset, strings.Join(dataset.Names(), ", "))
+	}
+	invert, err := parseInvertMode(*flInvert)
+	if err != nil {
+		return usageError{err}
+	}
+
+	net, err := nn.Load(*flModel)
+	if err != nil {
+		return err
+	}
+	if n := net.OutputSize(); n != info.NumClasses {
+		return fmt.Errorf("model has %d outputs but dataset %s has %d classes", n, info.Name, info.NumClasses)
+	}
+	opts := dataset.FolderOptions{Invert: invert, ClassNames: info.ClassNames}
+
+	ctx := context.Background()
+	var inputs, labels []*mathx.Matrix
+	if *flImages != "" {
+		if stat, err := os.Stat(*flImages); err != nil {
+			return err
+		} else if stat.IsDir() {
+			d, _, err := dataset.ReadImageFolder(ctx, os.DirFS(*flImages), opts)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < d.Len(); i++ {
+				s := d.Sample(i)
+				inputs, labels = append(inputs, s.Input), append(labels, s.Label)
+			}
+		} else {
+			file, err := os.Open(*flImages)
+			if err != nil {
+				return err
+			}
+			inputs, err = info.ReadImages(ctx, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if fs.NArg() > 0 && labels != nil {
+		return fmt.Errorf("image files can not be mixed with a labeled image directory")
+	}
+	for _, filename := range fs.Args() {
+		img, err := dataset.ReadImageFile(filename, opts)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, img.Vector())
+	}
+	if *flLabels != "" && labels == nil {
+		file, err := os.Open(*flLabels)
+		if err != nil {
+			return err
+		}
+		labels, err = info.ReadLabels(ctx, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if len(labels) != len(inputs) {
+			return fmt.Errorf("%w: %d images, %d labels", dataset.ErrCountMismatch, len(inputs), len(labels))
+		}
+	}
+
+	correct := 0
+	for i, input := range inputs {
+		output, err := net.PredictProba(input)
+		if err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+		j, _, score := output.MaxElem()
+		if labels == nil {
+			fmt.Printf("%d\t%s\t%.4f\n", i, info.ClassNames[j], score)
+			continue
+		}
+		k, _, _ := labels[i].MaxElem()
+		if j == k {
+			correct++
+		}
+		fmt.Printf("%d\t%s\t%.4f\t%s\n", i, info.ClassNames[j], score, info.ClassNames[k])
+	}
+	if labels != nil && len(inputs) > 0 {
+		fmt.Printf("accuracy = %.2f%%\n", mathx.Float(correct)/mathx.Float(len(inputs))*100)
+	}
+	return nil
+}
+
+func parseInvertMode(s string) (dataset.InvertMode, error) {
+	switch s {
+	case "auto":
+		return dataset.InvertAuto, nil
+	case "never":
+		return dataset.InvertNever, nil
+	case "always":
+		return dataset.InvertAlways, nil
+	}
+	return 0, fmt.Errorf("invalid invert mode %q", s)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/mkideal/mnist/nn"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the training configuration, it's read from a JSON or YAML file by
+// -config and flags override its fields
+type Config struct {
+	// Layers are sizes of hidden layers
+	Layers []int `json:"layers" yaml:"layers"`
+	// Activations of hidden layers, a single activation is used by all of them
+	Activations []string `json:"activations" yaml:"activations"`
+	Loss        string   `json:"loss" yaml:"loss"`
+	Epochs      int      `json:"epochs" yaml:"epochs"`
+	// BatchSize is the mini-batch size, 0 for 1/6000 of the training set
+	BatchSize int `json:"batch_size" yaml:"batch_size"`
+	// LearningRate is the step size, 0 for the default of the loss and
+	// optimizer
+	LearningRate float64 `json:"learning_rate" yaml:"learning_rate"`
+	// LRSchedule is a learning rate schedule spec, see nn.ParseScheduler
+	LRSchedule string `json:"lr_schedule" yaml:"lr_schedule"`
+	// Optimizer is an optimizer spec, see nn.ParseOptimizer
+	Optimizer      string         `json:"optimizer" yaml:"optimizer"`
+	Regularization Regularization `json:"regularization" yaml:"regularization"`
+	// Seed of initialization, shuffling and augmentation, 0 for current time
+	Seed int64 `json:"seed" yaml:"seed"`
+}
+
+// Regularization are strengths of weight penalties
+type Regularization struct {
+	L1 float64 `json:"l1" yaml:"l1"`
+	L2 float64 `json:"l2" yaml:"l2"`
+}
+
+// DefaultConfig trains a network with a hidden layer of 24 sigmoid nodes
+var DefaultConfig = Config{
+	Layers:      []int{24},
+	Activations: []string{nn.Sigmoid.Name},
+	Loss:        "cubic",
+	Epochs:      nn.DefaultEpochs,
+	Optimizer:   "sgd",
+}
+
+// ReadFile reads a config file over c, the file is YAML if its extension is
+// .yaml or .yml and JSON otherwise. Unknown fields are errors.
+func (c *Config) ReadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// WriteFile writes c to filename as JSON
+func (c *Config) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// String returns c as single line JSON
+func (c Config) String() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// configFile returns filename of the config saved next to a model file
+func configFile(model string) string {
+	return strings.TrimSuffix(model, filepath.Ext(model)) + ".config.json"
+}
+
+// flags defines flags of fields of c on fs
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.Var((*intList)(&c.Layers), "layers", "comma separated sizes of hidden layers")
+	fs.Var((*stringList)(&c.Activations), "activation", "comma separated activations of hidden layers: sigmoid, tanh, relu or leaky-relu, a single activation is used by all hidden layers")
+	fs.StringVar(&c.Loss, "loss", c.Loss, "loss: cubic, mse, bce, ce for softmax cross-entropy, hinge, smooth[=eps] for label smoothing, sce[=alpha,beta[,A]] for symmetric cross-entropy, bootstrap[=beta] or bootstrap-hard[=beta]")
+	fs.IntVar(&c.Epochs, "epochs", c.Epochs, "number of training epochs")
+	fs.IntVar(&c.BatchSize, "batch", c.BatchSize, "mini-batch size (default 1/6000 of the training set)")
+	fs.Float64Var(&c.LearningRate, "lr", c.LearningRate, "learning rate (default depends on the loss and optimizer)")
+	fs.StringVar(&c.LRSchedule, "lr-schedule", c.LRSchedule, "learning rate schedule: constant, step=every[,factor], exp[=gamma], cosine[=period[,mult]] with restarts, onecycle[=warmup fraction], plateau[=factor[,patience]] on validation accuracy, or warmup=epochs[+schedule]")
+	fs.StringVar(&c.Optimizer, "optimizer", c.Optimizer, "optimizer: sgd, momentum[=mu], nesterov[=mu], adagrad, rmsprop[=decay], adam or adamw[=weight decay]")
+	fs.Float64Var(&c.Regularization.L1, "l1", c.Regularization.L1, "L1 regularization strength")
+	fs.Float64Var(&c.Regularization.L2, "l2", c.Regularization.L2, "L2 regularization strength")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "random seed of initialization, shuffling and augmentation (default current time)")
+}
+
+// override sets fields of flags which are set on fs to their values
+func (c *Config) override(fs *flag.FlagSet) {
+	configFlags := flag.NewFlagSet("config", flag.ContinueOnError)
+	c.flags(configFlags)
+	fs.Visit(func(f *flag.Flag) {
+		if configFlags.Lookup(f.Name) != nil {
+			// values were parsed by fs
+			configFlags.Set(f.Name, f.Value.String())
+		}
+	})
+}
+
+// validate checks the config and parses its loss and activations
+func (c *Config) validate() (loss nn.Loss, activations []nn.Activation, err error) {
+	for _, size := range c.Layers {
+		if size <= 0 {
+			return nil, nil, fmt.Errorf("invalid layer size %d", size)
+		}
+	}
+	if len(c.Activations) == 0 {
+		return nil, nil, fmt.Errorf("no activations")
+	}
+	if len(c.Activations) != 1 && len(c.Activations) != len(c.Layers) {
+		return nil, nil, fmt.Errorf("%d activations for %d hidden layers", len(c.Activations), len(c.Layers))
+	}
+	for _, name := range c.Activations {
+		a, err := nn.ParseActivation(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		activations = append(activations, a)
+	}
+	if loss, err = nn.ParseLoss(c.Loss); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case c.Epochs <= 0:
+		return nil, nil, fmt.Errorf("invalid epochs %d", c.Epochs)
+	case c.BatchSize < 0:
+		return nil, nil, fmt.Errorf("invalid batch size %d", c.BatchSize)
+	case c.LearningRate < 0:
+		return nil, nil, fmt.Errorf("invalid learning rate %v", c.LearningRate)
+	case c.Regularization.L1 < 0 || c.Regularization.L2 < 0:
+		return nil, nil, fmt.Errorf("invalid regularization %+v", c.Regularization)
+	}
+	if _, err := c.newOptimizer(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.newScheduler(); err != nil {
+		return nil, nil, err
+	}
+	return loss, activations, nil
+}
+
+// newOptimizer returns a new optimizer of the configured spec, optimizers
+// keep state of a network so each network needs its own
+func (c *Config) newOptimizer() (nn.Optimizer, error) {
+	return nn.ParseOptimizer(c.Optimizer)
+}
+
+// newNetwork creates a network of the configured layers, activations and loss
+func (c *Config) newNetwork(inputs, classes int) (*nn.Network, error) {
+	loss, activations, err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+	sizes := append(append([]int{inputs}, c.Layers...), classes)
+	net, err := nn.New(sizes)
+	if err != nil {
+		return nil, err
+	}
+	net.SetLoss(loss)
+	if len(c.Layers) > 0 {
+		if err := net.SetActivations(activations...); err != nil {
+			return nil, err
+		}
+	}
+	return net, nil
+}
+
+// newScheduler returns a new learning rate scheduler of the configured spec,
+// nil if the learning rate is constant
+func (c *Config) newScheduler() (nn.Scheduler, error) {
+	return nn.ParseScheduler(c.LRSchedule)
+}
+
+// trainOptions returns options of training by optimizer and scheduler which
+// print learning rate, loss and validation accuracy after each epoch
+func (c *Config) trainOptions(validationdata *dataset.Dataset, optimizer nn.Optimizer, scheduler nn.Scheduler) nn.TrainOptions {
+	return nn.TrainOptions{
+		Validation:   validationdata,
+		Epochs:       c.Epochs,
+		LearningRate: mathx.Float(c.LearningRate),
+		Optimizer:    optimizer,
+		Scheduler:    scheduler,
+		Seed:         c.Seed,
+		L1:           mathx.Float(c.Regularization.L1),
+		L2:           mathx.Float(c.Regularization.L2),
+		OnEpoch: func(stats nn.EpochStats) {
+			fmt.Printf("epoch %2d: lr = %.4g, loss = %.4f", stats.Epoch, stats.LearningRate, stats.Loss)
+			if validationdata.Len() > 0 {
+				fmt.Printf(", validation loss = %.4f, validation accuracy = %.2f%%", stats.ValidationLoss, stats.ValidationAccuracy*100)
+			}
+			fmt.Println()
+		},
+	}
+}
+
+// intList is a comma separated list flag of ints
+type intList []int
+
+func (l *intList) String() string {
+	if l == nil {
+		return ""
+	}
+	fields := make([]string, len(*l))
+	for i, x := range *l {
+		fields[i] = strconv.Itoa(x)
+	}
+	return strings.Join(fields, ",")
+}
+
+func (l *intList) Set(s string) error {
+	*l = nil
+	if s == "" {
+		return nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		x, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, x)
+	}
+	return nil
+}
+
+// stringList is a comma separated list flag of strings
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, field := range strings.Split(s, ",") {
+		*l = append(*l, strings.TrimSpace(field))
+	}
+	return nil
+}
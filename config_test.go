@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mkideal/mnist/nn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(yamlFile, []byte(`
+layers: [32, 16]
+activations: [relu, tanh]
+epochs: 3
+learning_rate: 0.1
+regularization:
+  l2: 0.001
+`), 0644))
+
+	cfg := DefaultConfig
+	if !assert.NoError(t, cfg.ReadFile(yamlFile)) {
+		return
+	}
+	assert.Equal(t, []int{32, 16}, cfg.Layers)
+	assert.Equal(t, []string{"relu", "tanh"}, cfg.Activations)
+	assert.Equal(t, "cubic", cfg.Loss, "defaults are kept")
+	assert.Equal(t, 0.001, cfg.Regularization.L2)
+
+	// flags override the file
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagConfig := DefaultConfig
+	flagConfig.flags(fs)
+	assert.NoError(t, fs.Parse([]string{"-epochs", "5", "-layers", "8", "-activation", "sigmoid", "-l1", "0.5"}))
+	cfg.override(fs)
+	assert.Equal(t, 5, cfg.Epochs)
+	assert.Equal(t, []int{8}, cfg.Layers)
+	assert.Equal(t, []string{"sigmoid"}, cfg.Activations)
+	assert.Equal(t, 0.1, cfg.LearningRate, "file value not overridden")
+	assert.Equal(t, Regularization{L1: 0.5, L2: 0.001}, cfg.Regularization)
+	assert.Equal(t, []int{24}, DefaultConfig.Layers)
+
+	net, err := cfg.newNetwork(4, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{4, 8, 2}, net.Sizes())
+		assert.Equal(t, nn.Sigmoid.Name, net.Activations()[0].Name)
+	}
+
+	// the saved config reads back
+	jsonFile := filepath.Join(dir, "model.config.json")
+	assert.Equal(t, jsonFile, configFile(filepath.Join(dir, "model.gob")))
+	assert.NoError(t, cfg.WriteFile(jsonFile))
+	var cfg2 Config
+	assert.NoError(t, cfg2.ReadFile(jsonFile))
+	assert.Equal(t, cfg, cfg2)
+
+	assert.NoError(t, os.WriteFile(yamlFile, []byte("layer: [1]\n"), 0644))
+	assert.Error(t, (&Config{}).ReadFile(yamlFile), "unknown field")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`{"epoch": 1}`), 0644))
+	assert.Error(t, (&Config{}).ReadFile(jsonFile), "unknown field")
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, modify := range []func(c *Config){
+		func(c *Config) { c.Layers = []int{0} },
+		func(c *Config) { c.Activations = nil },
+		func(c *Config) { c.Layers, c.Activations = []int{8, 8, 8}, []string{"relu", "relu"} },
+		func(c *Config) { c.Activations = []string{"softsign"} },
+		func(c *Config) { c.Loss = "unknown" },
+		func(c *Config) { c.Epochs = 0 },
+		func(c *Config) { c.BatchSize = -1 },
+		func(c *Config) { c.LearningRate = -1 },
+		func(c *Config) { c.Regularization.L2 = -1 },
+		func(c *Config) { c.Optimizer = "unknown" },
+		func(c *Config) { c.LRSchedule = "warmup" },
+	} {
+		cfg := DefaultConfig
+		modify(&cfg)
+		_, _, err := cfg.validate()
+		assert.Error(t, err, "%v", cfg)
+	}
+	_, _, err := DefaultConfig.validate()
+	assert.NoError(t, err)
+}
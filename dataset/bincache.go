@@ -0,0 +1,214 @@
+package dataset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var ErrBinaryCache = errors.New("invalid binary cache")
+
+// BinaryCache stores decoded datasets as uncompressed binary files which are
+// memory-mapped when loaded again, so that loading is near-instant and
+// processes on one machine share pages. A cache file is rebuilt if its
+// source files or the dataset format change.
+//
+// The file layout is little endian:
+//
+//	magic      [8]byte "MNISTBIN"
+//	version    uint32
+//	checksum   uint32 CRC-32C of the rest of the file
+//	rows       uint32
+//	cols       uint32
+//	numClasses uint32
+//	reserved   uint32
+//	count      uint64
+//	source     [32]byte SHA-256 of source files and format
+//	images     [count*rows*cols]uint8
+//	labels     [count]uint8
+//
+// Mapped datasets are never unmapped, they are private copy-on-write
+// mappings so writing pixels doesn't change the file.
+type BinaryCache struct {
+	// Dir is the cache directory, bin in DefaultDownloader.Dir() if empty
+	Dir string
+	// Disabled makes datasets always decoded from source files
+	Disabled bool
+}
+
+// DefaultBinaryCache is used to load datasets from local or downloaded files.
+// It's disabled by default so that library callers don't write to the cache
+// directory unless they opt in by clearing Disabled.
+var DefaultBinaryCache = &BinaryCache{Disabled: true}
+
+const (
+	binaryCacheMagic   = "MNISTBIN"
+	binaryCacheVersion = 1
+	binaryHeaderSize   = 72
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Path returns the directory of cache files
+func (c *BinaryCache) Path() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	return filepath.Join(DefaultDownloader.Dir(), "bin")
+}
+
+// sourceKey returns name of the cache file and key of the content which
+// changes if any source file is modified
+func (c *BinaryCache) sourceKey(f format, imageFile, labelFile string) (filename string, key [32]byte, err error) {
+	name, content := sha256.New(), sha256.New()
+	fmt.Fprintf(name, "%d %d %v\n", f.numClasses, f.labelOffset, f.transposed)
+	for _, file := range []string{imageFile, labelFile} {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", key, err
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			return "", key, err
+		}
+		fmt.Fprintf(name, "%s\n", abs)
+		fmt.Fprintf(content, "%s %d %d\n", abs, stat.Size(), stat.ModTime().UnixNano())
+	}
+	content.Write(name.Sum(nil))
+	copy(key[:], content.Sum(nil))
+	return filepath.Join(c.Path(), hex.EncodeToString(name.Sum(nil)[:16])+".bin"), key, nil
+}
+
+// load returns the cached dataset of source files, decode is called and its
+// result is cached if the cache is missing or doesn't match
+func (c *BinaryCache) load(f format, imageFile, labelFile string, decode func() (*Dataset, error)) (*Dataset, error) {
+	if c.Disabled {
+		return decode()
+	}
+	filename, key, err := c.sourceKey(f, imageFile, labelFile)
+	if err != nil {
+		return nil, err
+	}
+	d, err := openBinaryCache(filename, key)
+	if err == nil {
+		return d, nil
+	}
+	if !os.IsNotExist(err) {
+		log.Printf("%s: %v, rebuilding", filename, err)
+	}
+	if d, err = decode(); err != nil {
+		return nil, err
+	}
+	if err := writeBinaryCache(filename, key, d); err != nil {
+		log.Printf("write binary cache: %v", err)
+	}
+	return d, nil
+}
+
+func openBinaryCache(filename string, key [32]byte) (*Dataset, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < binaryHeaderSize {
+		return nil, fmt.Errorf("%w: file too small", ErrBinaryCache)
+	}
+	data, err := mapFile(file, int(stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+	d, err := decodeBinaryCache(data, key)
+	if err != nil {
+		unmapFile(data)
+		return nil, err
+	}
+	return d, nil
+}
+
+func decodeBinaryCache(data []byte, key [32]byte) (*Dataset, error) {
+	if string(data[:8]) != binaryCacheMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrBinaryCache)
+	}
+	if version := binary.LittleEndian.Uint32(data[8:]); version != binaryCacheVersion {
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrBinaryCache, version, binaryCacheVersion)
+	}
+	if !bytes.Equal(data[40:72], key[:]) {
+		return nil, fmt.Errorf("%w: source files changed", ErrBinaryCache)
+	}
+	rows := int(binary.LittleEndian.Uint32(data[16:]))
+	cols := int(binary.LittleEndian.Uint32(data[20:]))
+	numClasses := int(binary.LittleEndian.Uint32(data[24:]))
+	count := binary.LittleEndian.Uint64(data[32:])
+	size := uint64(rows) * uint64(cols)
+	if count > uint64(len(data)) || size > uint64(len(data)) || binaryHeaderSize+count*(size+1) != uint64(len(data)) {
+		return nil, fmt.Errorf("%w: size mismatch", ErrBinaryCache)
+	}
+	if sum := crc32.Checksum(data[16:], castagnoli); sum != binary.LittleEndian.Uint32(data[12:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBinaryCache)
+	}
+	n := int(count)
+	images := data[binaryHeaderSize : binaryHeaderSize+n*int(size)]
+	return &Dataset{
+		Rows:       rows,
+		Cols:       cols,
+		NumClasses: numClasses,
+		Images:     images[:len(images):len(images)],
+		Labels:     data[len(data)-n:],
+	}, nil
+}
+
+// writeBinaryCache writes d to a temporary file and renames it to filename so
+// that concurrent readers never see a partial file
+func writeBinaryCache(filename string, key [32]byte, d *Dataset) (err error) {
+	header := make([]byte, binaryHeaderSize)
+	copy(header, binaryCacheMagic)
+	binary.LittleEndian.PutUint32(header[8:], binaryCacheVersion)
+	binary.LittleEndian.PutUint32(header[16:], uint32(d.Rows))
+	binary.LittleEndian.PutUint32(header[20:], uint32(d.Cols))
+	binary.LittleEndian.PutUint32(header[24:], uint32(d.NumClasses))
+	binary.LittleEndian.PutUint64(header[32:], uint64(d.Len()))
+	copy(header[40:], key[:])
+	sum := crc32.Update(0, castagnoli, header[16:])
+	sum = crc32.Update(sum, castagnoli, d.Images)
+	sum = crc32.Update(sum, castagnoli, d.Labels)
+	binary.LittleEndian.PutUint32(header[12:], sum)
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	// CreateTemp creates files readable by the owner only
+	if err := file.Chmod(0644); err != nil {
+		return err
+	}
+	for _, b := range [][]byte{header, d.Images, d.Labels} {
+		if _, err := file.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
@@ -0,0 +1,109 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryCache(t *testing.T) {
+	imageFile, labelFile := writeTestFiles(t, 12, 12)
+	c := &BinaryCache{Dir: t.TempDir()}
+	f := MNIST.format()
+	decoded := 0
+	load := func() *Dataset {
+		d, err := c.load(f, imageFile, labelFile, func() (*Dataset, error) {
+			decoded++
+			return f.decodeFiles(context.Background(), imageFile, labelFile)
+		})
+		assert.NoError(t, err)
+		return d
+	}
+
+	want := load()
+	assert.Equal(t, 1, decoded)
+	assert.Equal(t, want, load())
+	assert.Equal(t, 1, decoded)
+
+	files, _ := filepath.Glob(filepath.Join(c.Dir, "*.bin"))
+	if !assert.Equal(t, 1, len(files)) {
+		return
+	}
+	filename := files[0]
+
+	// mapped pixels are copy-on-write
+	d := load()
+	d.Images[0] = 255
+	assert.Equal(t, want, load())
+	assert.Equal(t, 1, decoded)
+
+	// corrupted cache is rebuilt
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 1
+	assert.NoError(t, os.WriteFile(filename, data, 0644))
+	assert.Equal(t, want, load())
+	assert.Equal(t, 2, decoded)
+	assert.Equal(t, want, load())
+	assert.Equal(t, 2, decoded)
+
+	// modified source is rebuilt
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(imageFile, later, later))
+	load()
+	assert.Equal(t, 3, decoded)
+
+	// a different format uses a different cache file
+	f.transposed = true
+	load()
+	assert.Equal(t, 4, decoded)
+	files, _ = filepath.Glob(filepath.Join(c.Dir, "*.bin"))
+	assert.Equal(t, 2, len(files))
+
+	c.Disabled = true
+	load()
+	load()
+	assert.Equal(t, 6, decoded)
+}
+
+func TestDecodeBinaryCache(t *testing.T) {
+	d := testDataset(5)
+	filename := filepath.Join(t.TempDir(), "d.bin")
+	key := [32]byte{1, 2, 3}
+	if !assert.NoError(t, writeBinaryCache(filename, key, d)) {
+		return
+	}
+	data, err := os.ReadFile(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	got, err := decodeBinaryCache(data, key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d, got)
+	}
+
+	_, err = decodeBinaryCache(data, [32]byte{})
+	assert.True(t, errors.Is(err, ErrBinaryCache), "got %v", err)
+	for _, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { b[0] = 'X'; return b },
+		func(b []byte) []byte { b[8] = 2; return b },
+		func(b []byte) []byte { b[32] = 6; return b },
+		func(b []byte) []byte { return b[:len(b)-1] },
+		func(b []byte) []byte { b[binaryHeaderSize] ^= 1; return b },
+	} {
+		_, err := decodeBinaryCache(corrupt(append([]byte(nil), data...)), key)
+		assert.True(t, errors.Is(err, ErrBinaryCache), "got %v", err)
+	}
+
+	empty := &Dataset{Rows: 2, Cols: 2, NumClasses: 10}
+	assert.NoError(t, writeBinaryCache(filename, key, empty))
+	got, err = openBinaryCache(filename, key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, got.Len())
+	}
+}
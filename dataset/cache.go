@@ -0,0 +1,151 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownChecksum = errors.New("unknown checksum")
+
+// CacheEntry is a file in the cache directory of a Downloader
+type CacheEntry struct {
+	Filename string
+	Size     int64
+	// Dataset is the name of the registered dataset which the file belongs to, empty if unknown
+	Dataset string
+	// Checksum is the known SHA-256 of the file, empty if unknown
+	Checksum string
+	// Partial reports whether the file is an interrupted download
+	Partial bool
+}
+
+// Verify verifies checksum of the cached file
+func (e CacheEntry) Verify() error {
+	if e.Checksum == "" {
+		return ErrUnknownChecksum
+	}
+	return verifyFile(e.Filename, e.Checksum)
+}
+
+// knownFiles returns registered datasets and checksums of files downloaded
+// from their default URL indexed by cache filename, and of all files of
+// registered datasets indexed by file name
+func (d *Downloader) knownFiles() (byPath map[string]CacheEntry, byName map[string][]CacheEntry) {
+	byPath = make(map[string]CacheEntry)
+	byName = make(map[string][]CacheEntry)
+	for _, name := range Names() {
+		info := registry[name]
+		for _, file := range []string{info.TrainingImages, info.TrainingLabels, info.TestImages, info.TestLabels} {
+			entry := CacheEntry{Dataset: info.Name, Checksum: info.Checksums[file]}
+			byName[file] = append(byName[file], entry)
+			if info.URL == "" {
+				continue
+			}
+			if filename, err := d.CacheFilename(joinFilename(info.URL, file)); err == nil {
+				byPath[filename] = entry
+			}
+		}
+	}
+	return byPath, byName
+}
+
+// identify returns the known entry of a file downloaded from a mirror, it's
+// matched by file name and checksum since datasets have files of the same
+// name. Partial files and files without known checksum are matched by name
+// only if the name is unique.
+func identify(filename string, partial bool, byName map[string][]CacheEntry) (CacheEntry, error) {
+	candidates := byName[filepath.Base(filename)]
+	if len(candidates) == 1 && (partial || candidates[0].Checksum == "") {
+		return candidates[0], nil
+	}
+	if partial || len(candidates) == 0 {
+		return CacheEntry{}, nil
+	}
+	sum, err := fileChecksum(filename)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	for _, entry := range candidates {
+		if strings.EqualFold(entry.Checksum, sum) {
+			return entry, nil
+		}
+	}
+	return CacheEntry{}, nil
+}
+
+// List returns all files in the cache directory sorted by filename
+func (d *Downloader) List() ([]CacheEntry, error) {
+	byPath, byName := d.knownFiles()
+	var entries []CacheEntry
+	err := filepath.WalkDir(d.Dir(), func(filename string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filename == d.Dir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		partial := strings.HasSuffix(filename, ".part")
+		entry, ok := byPath[strings.TrimSuffix(filename, ".part")]
+		if !ok {
+			if entry, err = identify(strings.TrimSuffix(filename, ".part"), partial, byName); err != nil {
+				return err
+			}
+		}
+		entry.Filename = filename
+		entry.Size = info.Size()
+		entry.Partial = partial
+		entries = append(entries, entry)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Filename < entries[j].Filename })
+	return entries, err
+}
+
+// Clean removes cached files of given datasets, or all files owned by the
+// cache if no dataset specified: files of registered datasets, interrupted
+// downloads and the binary cache in subdirectory bin. Other files in the
+// cache directory are kept since it may be shared, e.g. set to a home
+// directory by mistake.
+func (d *Downloader) Clean(datasets ...string) error {
+	for _, name := range datasets {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("unknown dataset %q", name)
+		}
+	}
+	entries, err := d.List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		remove := false
+		if len(datasets) == 0 {
+			remove = entry.Dataset != "" || entry.Partial
+		}
+		for _, name := range datasets {
+			if entry.Dataset == name {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(entry.Filename); err != nil {
+				return err
+			}
+		}
+	}
+	if len(datasets) == 0 {
+		return os.RemoveAll(filepath.Join(d.Dir(), "bin"))
+	}
+	return nil
+}
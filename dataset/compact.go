@@ -0,0 +1,154 @@
+package dataset
+
+import (
+	"fmt"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Dataset stores images and labels compactly as bytes, images are converted
+// to normalized float matrices on demand.
+type Dataset struct {
+	Rows, Cols int
+	NumClasses int
+	// Images holds pixels of all images, image i is Images[i*Rows*Cols:(i+1)*Rows*Cols]
+	Images []uint8
+	// Labels holds class index of all images
+	Labels []uint8
+}
+
+// NewDataset converts samples to a Dataset, inputs are expected in range [0, 1]
+func NewDataset(set []*Sample, rows, cols int) (*Dataset, error) {
+	if err := Validate(set); err != nil {
+		return nil, err
+	}
+	d := &Dataset{Rows: rows, Cols: cols}
+	if len(set) == 0 {
+		return d, nil
+	}
+	size := rows * cols
+	if set[0].Input.RowCount() != size {
+		return nil, fmt.Errorf("%w: input size %d, want %dx%d", ErrShape, set[0].Input.RowCount(), rows, cols)
+	}
+	d.NumClasses = set[0].Label.RowCount()
+	d.Images = make([]uint8, 0, len(set)*size)
+	d.Labels = make([]uint8, len(set))
+	for i, s := range set {
+		for _, x := range s.Input.Slice() {
+			d.Images = append(d.Images, toPixel(x))
+		}
+		label, _, _ := s.Label.MaxElem()
+		d.Labels[i] = uint8(label)
+	}
+	return d, nil
+}
+
+func toPixel(x mathx.Float) uint8 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 255
+	}
+	return uint8(x*255 + 0.5)
+}
+
+func toInput(pixels []uint8) *mathx.Matrix {
+	vec := mathx.NewMatrix(len(pixels), 1)
+	for j, b := range pixels {
+		vec.Set(j, 0, mathx.Float(b)/255)
+	}
+	return vec
+}
+
+func toLabel(label, numClasses int) *mathx.Matrix {
+	vec := mathx.NewMatrix(numClasses, 1)
+	vec.Set(label, 0, 1)
+	return vec
+}
+
+// Len returns number of samples
+func (d *Dataset) Len() int { return len(d.Labels) }
+
+// ImageSize returns number of pixels of an image
+func (d *Dataset) ImageSize() int { return d.Rows * d.Cols }
+
+// Image returns pixels of the i-th image
+func (d *Dataset) Image(i int) []uint8 {
+	size := d.ImageSize()
+	return d.Images[i*size : (i+1)*size]
+}
+
+// Label returns class index of the i-th sample
+func (d *Dataset) Label(i int) int { return int(d.Labels[i]) }
+
+// Input returns the i-th image as a normalized column vector
+func (d *Dataset) Input(i int) *mathx.Matrix { return toInput(d.Image(i)) }
+
+// Sample converts the i-th sample
+func (d *Dataset) Sample(i int) *Sample {
+	return &Sample{Input: d.Input(i), Label: toLabel(d.Label(i), d.NumClasses)}
+}
+
+// Samples converts all samples
+func (d *Dataset) Samples() []*Sample {
+	return d.SamplesAt(nil)
+}
+
+// SamplesAt converts samples at indices, all samples converted if indices is nil
+func (d *Dataset) SamplesAt(indices []int) []*Sample {
+	if indices == nil {
+		result := make([]*Sample, d.Len())
+		for i := range result {
+			result[i] = d.Sample(i)
+		}
+		return result
+	}
+	result := make([]*Sample, len(indices))
+	for i, index := range indices {
+		result[i] = d.Sample(index)
+	}
+	return result
+}
+
+// Batch converts samples at indices to stacked matrices, the k-th column of
+// inputs and labels is the sample at indices[k].
+func (d *Dataset) Batch(indices []int) (inputs, labels *mathx.Matrix) {
+	inputs = mathx.NewMatrix(d.ImageSize(), len(indices))
+	labels = mathx.NewMatrix(d.NumClasses, len(indices))
+	for k, index := range indices {
+		for j, b := range d.Image(index) {
+			inputs.Set(j, k, mathx.Float(b)/255)
+		}
+		labels.Set(d.Label(index), k, 1)
+	}
+	return
+}
+
+// Slice returns samples in [i, j), the result shares memory with d
+func (d *Dataset) Slice(i, j int) *Dataset {
+	size := d.ImageSize()
+	return &Dataset{
+		Rows:       d.Rows,
+		Cols:       d.Cols,
+		NumClasses: d.NumClasses,
+		Images:     d.Images[i*size : j*size],
+		Labels:     d.Labels[i:j],
+	}
+}
+
+// Subset copies samples at indices to a new Dataset
+func (d *Dataset) Subset(indices []int) *Dataset {
+	sub := &Dataset{
+		Rows:       d.Rows,
+		Cols:       d.Cols,
+		NumClasses: d.NumClasses,
+		Images:     make([]uint8, 0, len(indices)*d.ImageSize()),
+		Labels:     make([]uint8, len(indices)),
+	}
+	for k, index := range indices {
+		sub.Images = append(sub.Images, d.Image(index)...)
+		sub.Labels[k] = d.Labels[index]
+	}
+	return sub
+}
@@ -0,0 +1,297 @@
+package dataset
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// CSVReader reads samples one by one from a CSV stream in Kaggle format:
+//
+//	label,pixel0,pixel1,...,pixel783
+//	1,0,0,...,0
+//
+// The header is optional. Files without label column are unlabeled, without a
+// header a file is labeled if the number of pixels is a square. Gzip
+// compressed stream is detected by its magic bytes and decompressed.
+type CSVReader struct {
+	r          *csv.Reader
+	closer     io.Closer
+	numClasses int
+	labeled    bool
+	size       int
+	first      []string // first record if it isn't a header
+}
+
+// NewCSVReader reads the first record of r to detect the header and layout
+func NewCSVReader(r io.Reader, numClasses int) (*CSVReader, error) {
+	cr := &CSVReader{numClasses: numClasses}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzreader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, withName(r, err)
+		}
+		cr.closer = gzreader
+		br = bufio.NewReader(gzreader)
+	}
+	cr.r = csv.NewReader(br)
+	cr.r.ReuseRecord = true
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, withName(r, fmt.Errorf("%w: empty CSV", ErrFormat))
+	} else if err != nil {
+		return nil, withName(r, fmt.Errorf("%w: %v", ErrFormat, err))
+	}
+	if _, err := strconv.Atoi(strings.TrimSpace(record[0])); err != nil {
+		// header
+		cr.labeled = strings.EqualFold(strings.TrimSpace(record[0]), "label")
+	} else {
+		cr.labeled = isSquare(len(record) - 1)
+		cr.first = append([]string(nil), record...)
+	}
+	cr.size = len(record)
+	if cr.labeled {
+		cr.size--
+	}
+	if cr.size == 0 {
+		return nil, withName(r, fmt.Errorf("%w: no pixel columns", ErrShape))
+	}
+	return cr, nil
+}
+
+func isSquare(n int) bool {
+	k := int(math.Sqrt(float64(n)))
+	return n > 0 && k*k == n
+}
+
+// Labeled reports whether records have a label column
+func (r *CSVReader) Labeled() bool { return r.labeled }
+
+// ImageSize returns number of pixels of each image
+func (r *CSVReader) ImageSize() int { return r.size }
+
+// Read reads the next record into pixels which must have ImageSize elements
+// and returns its label, label is -1 if the file is unlabeled. It returns
+// io.EOF at the end of input.
+func (r *CSVReader) Read(pixels []uint8) (label int, err error) {
+	record := r.first
+	r.first = nil
+	if record == nil {
+		if record, err = r.r.Read(); err == io.EOF {
+			return 0, err
+		} else if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+	}
+	line, _ := r.r.FieldPos(0)
+	label = -1
+	if r.labeled {
+		label, err = strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil || label < 0 || label >= r.numClasses {
+			return 0, fmt.Errorf("line %d: %w: label %q out of range [0, %d)", line, ErrLabel, record[0], r.numClasses)
+		}
+		record = record[1:]
+	}
+	for i, field := range record {
+		x, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || x < 0 || x > 255 {
+			return 0, fmt.Errorf("line %d: %w: pixel %d: %q is not in range [0, 255]", line, ErrFormat, i, field)
+		}
+		pixels[i] = uint8(x)
+	}
+	return label, nil
+}
+
+// Next reads the next sample, Label of the sample is nil if the file is unlabeled
+func (r *CSVReader) Next() (*Sample, error) {
+	pixels := make([]uint8, r.size)
+	label, err := r.Read(pixels)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sample{Input: toInput(pixels)}
+	if label >= 0 {
+		s.Label = toLabel(label, r.numClasses)
+	}
+	return s, nil
+}
+
+// Close closes the gzip stream if the input is compressed
+func (r *CSVReader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// ReadCSV reads all samples from a CSV stream, see CSVReader for the format.
+// Label of samples is nil if the file is unlabeled.
+func ReadCSV(ctx context.Context, r io.Reader, numClasses int) ([]*Sample, error) {
+	cr, err := NewCSVReader(contextReader{ctx, r}, numClasses)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	var set []*Sample
+	for {
+		s, err := cr.Next()
+		if err == io.EOF {
+			return set, nil
+		} else if err != nil {
+			return nil, withName(r, err)
+		}
+		set = append(set, s)
+	}
+}
+
+// ReadCSVDataset reads a labeled CSV stream of square images into a compact Dataset
+func ReadCSVDataset(ctx context.Context, r io.Reader, numClasses int) (*Dataset, error) {
+	cr, err := NewCSVReader(contextReader{ctx, r}, numClasses)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	if !cr.Labeled() {
+		return nil, withName(r, fmt.Errorf("%w: CSV has no label column", ErrFormat))
+	}
+	if !isSquare(cr.ImageSize()) {
+		return nil, withName(r, fmt.Errorf("%w: %d pixels is not a square image", ErrShape, cr.ImageSize()))
+	}
+	side := int(math.Sqrt(float64(cr.ImageSize())))
+	d := &Dataset{Rows: side, Cols: side, NumClasses: numClasses}
+	pixels := make([]uint8, cr.ImageSize())
+	for {
+		label, err := cr.Read(pixels)
+		if err == io.EOF {
+			return d, nil
+		} else if err != nil {
+			return nil, withName(r, err)
+		}
+		d.Images = append(d.Images, pixels...)
+		d.Labels = append(d.Labels, uint8(label))
+	}
+}
+
+// WriteCSV writes samples in Kaggle format with a header, the label column is
+// written if all samples are labeled. Inputs are converted to integer pixels.
+func WriteCSV(w io.Writer, set []*Sample) error {
+	if len(set) == 0 {
+		return nil
+	}
+	if err := Validate(unlabeled(set)); err != nil {
+		return err
+	}
+	labeled := true
+	for _, s := range set {
+		if s.Label == nil {
+			labeled = false
+			break
+		}
+	}
+	cw := NewCSVWriter(w, set[0].Input.RowCount(), labeled)
+	for _, s := range set {
+		label := -1
+		if labeled {
+			label, _, _ = s.Label.MaxElem()
+		}
+		if err := cw.Write(s.Input, label); err != nil {
+			return err
+		}
+	}
+	return cw.Flush()
+}
+
+// unlabeled returns samples with a dummy label so that they can be validated
+func unlabeled(set []*Sample) []*Sample {
+	dummy := mathx.NewMatrix(1, 1)
+	result := make([]*Sample, len(set))
+	for i, s := range set {
+		if s != nil {
+			result[i] = &Sample{Input: s.Input, Label: dummy}
+		}
+	}
+	return result
+}
+
+// CSVWriter writes samples one by one in Kaggle format
+type CSVWriter struct {
+	w       *csv.Writer
+	size    int
+	labeled bool
+	record  []string
+	header  bool
+}
+
+// NewCSVWriter creates a writer of images with size pixels, the header is
+// written with the first record
+func NewCSVWriter(w io.Writer, size int, labeled bool) *CSVWriter {
+	n := size
+	if labeled {
+		n++
+	}
+	return &CSVWriter{w: csv.NewWriter(w), size: size, labeled: labeled, record: make([]string, n)}
+}
+
+func (w *CSVWriter) writeHeader() error {
+	w.header = true
+	record := w.record[:0]
+	if w.labeled {
+		record = append(record, "label")
+	}
+	for i := 0; i < w.size; i++ {
+		record = append(record, "pixel"+strconv.Itoa(i))
+	}
+	return w.w.Write(record)
+}
+
+// Write writes an input vector and its class, label is ignored if the writer is unlabeled
+func (w *CSVWriter) Write(input *mathx.Matrix, label int) error {
+	if input.RowCount() != w.size {
+		return fmt.Errorf("%w: input size %d, want %d", ErrShape, input.RowCount(), w.size)
+	}
+	pixels := make([]uint8, w.size)
+	for i := range pixels {
+		pixels[i] = toPixel(input.Get(i, 0))
+	}
+	return w.WritePixels(pixels, label)
+}
+
+// WritePixels writes pixels of an image and its class
+func (w *CSVWriter) WritePixels(pixels []uint8, label int) error {
+	if len(pixels) != w.size {
+		return fmt.Errorf("%w: image size %d, want %d", ErrShape, len(pixels), w.size)
+	}
+	if !w.header {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	record := w.record[:0]
+	if w.labeled {
+		record = append(record, strconv.Itoa(label))
+	}
+	for _, b := range pixels {
+		record = append(record, strconv.Itoa(int(b)))
+	}
+	return w.w.Write(record)
+}
+
+// Flush writes buffered data to the underlying writer
+func (w *CSVWriter) Flush() error {
+	if !w.header {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
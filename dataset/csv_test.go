@@ -0,0 +1,87 @@
+package dataset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSV(t *testing.T) {
+	d := testDataset(12)
+	d.Rows, d.Cols = 1, 4
+	d.Images = append(d.Images, d.Images...)
+	var buf bytes.Buffer
+	if !assert.NoError(t, WriteCSV(&buf, d.Samples())) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(buf.String(), "label,pixel0,pixel1,pixel2,pixel3\n0,0,0,1,0\n"), buf.String())
+
+	set, err := ReadCSV(context.Background(), bytes.NewReader(buf.Bytes()), 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d.Samples(), set)
+	}
+	d2, err := ReadCSVDataset(context.Background(), bytes.NewReader(buf.Bytes()), 10)
+	if assert.NoError(t, err) {
+		d2.Rows, d2.Cols = d.Rows, d.Cols
+		assert.Equal(t, d, d2)
+	}
+
+	// gzip compressed
+	var gz bytes.Buffer
+	gzwriter := gzip.NewWriter(&gz)
+	gzwriter.Write(buf.Bytes())
+	assert.NoError(t, gzwriter.Close())
+	set, err = ReadCSV(context.Background(), &gz, 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 12, len(set))
+	}
+}
+
+func TestCSVLayout(t *testing.T) {
+	for _, tc := range []struct {
+		data    string
+		labeled bool
+		size    int
+		n       int
+	}{
+		{"label,pixel0,pixel1,pixel2,pixel3\n1,0,0,0,255\n", true, 4, 1},
+		{"pixel0,pixel1,pixel2,pixel3\n0,0,0,255\n1,2,3,4\n", false, 4, 2},
+		{"1,0,0,0,255\n", true, 4, 1},
+		{"1,0,0,255\n1,2,3,4\n", false, 4, 2},
+	} {
+		r, err := NewCSVReader(strings.NewReader(tc.data), 10)
+		if !assert.NoError(t, err, tc.data) {
+			continue
+		}
+		assert.Equal(t, tc.labeled, r.Labeled(), tc.data)
+		assert.Equal(t, tc.size, r.ImageSize(), tc.data)
+		set, err := ReadCSV(context.Background(), strings.NewReader(tc.data), 10)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.n, len(set))
+			assert.Equal(t, tc.labeled, set[0].Label != nil)
+		}
+	}
+
+	for data, target := range map[string]error{
+		"":                       ErrFormat,
+		"label\n":                ErrShape,
+		"1,0,0,0,256\n":          ErrFormat,
+		"10,0,0,0,0\n":           ErrLabel,
+		"1,0,0,0,0\n1,0,0,0\n":   ErrFormat,
+		"label,p0\n1,x\n":        ErrFormat,
+		"pixel0,pixel1\n1,2,3\n": ErrFormat,
+	} {
+		_, err := ReadCSV(context.Background(), strings.NewReader(data), 10)
+		assert.True(t, errors.Is(err, target), "%q: got %v", data, err)
+	}
+
+	_, err := ReadCSVDataset(context.Background(), strings.NewReader("1,2,3\n"), 10)
+	assert.True(t, errors.Is(err, ErrFormat), "got %v", err)
+	_, err = ReadCSVDataset(context.Background(), strings.NewReader("label,a,b\n1,2,3\n"), 10)
+	assert.True(t, errors.Is(err, ErrShape), "got %v", err)
+}
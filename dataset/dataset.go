@@ -1,23 +1,25 @@
 package dataset
 
 import (
-	"bufio"
-	"compress/gzip"
-	"encoding/binary"
+	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/mkideal/mnist/dataset/idx"
 	"github.com/mkideal/mnist/mathx"
 )
 
 var (
-	ErrLabel = errors.New("error label")
+	ErrLabel         = errors.New("error label")
+	ErrFormat        = errors.New("unexpected data format")
+	ErrCountMismatch = errors.New("count mismatch")
+	ErrShape         = errors.New("bad shape")
 )
 
 type Sample struct {
@@ -27,189 +29,280 @@ type Sample struct {
 
 // @see http://yann.lecun.com/exdb/mnist/
 
-func ReadTrainingSet(imageFile, labelFile string) (result []*Sample, err error) {
-	if result, err = readImages(imageFile, result); err == nil {
-		result, err = readLabels(labelFile, result)
-	}
-	return
+// format describes how to decode images and labels of a dataset
+type format struct {
+	numClasses  int
+	labelOffset int
+	transposed  bool
+	checksums   map[string]string
+}
+
+func (f format) checksum(filename string) string {
+	return f.checksums[path.Base(filename)]
 }
 
-func ReadTestSet(imageFile, labelFile string) (result []*Sample, err error) {
-	if result, err = readImages(imageFile, result); err == nil {
-		result, err = readLabels(labelFile, result)
+func ReadTrainingSet(imageFile, labelFile string) ([]*Sample, error) {
+	d, err := MNIST.format().readFiles(context.Background(), imageFile, labelFile)
+	if err != nil {
+		return nil, err
 	}
-	return
+	return d.Samples(), nil
 }
 
-func SplitTrainingSet(set []*Sample) (trainingdata, validationset []*Sample) {
-	n := 5 * len(set) / 6
-	return set[:n], set[n:]
+func ReadTestSet(imageFile, labelFile string) ([]*Sample, error) {
+	return ReadTrainingSet(imageFile, labelFile)
 }
 
-func isFileExist(filename string) bool {
-	_, err := os.Stat(filename)
-	if err != nil {
-		return !os.IsNotExist(err)
-	}
-	return true
+// ReadImages reads MNIST images from r which may be gzip compressed
+func ReadImages(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	return MNIST.format().readImages(ctx, r)
 }
 
-func tryDownload(filename string) (string, error) {
-	if strings.HasPrefix(filename, "http://") || strings.HasSuffix(filename, "https://") {
-		cacheDir, err := os.UserHomeDir()
-		if err != nil {
-			cacheDir = ".cache"
-		} else {
-			cacheDir = filepath.Join(cacheDir, ".cache", "download")
-		}
-		if err := os.MkdirAll(cacheDir, 0755); err != nil {
-			return "", err
-		}
-		_, name := path.Split(filename)
-		cacheFilename := filepath.Join(cacheDir, name)
-		if isFileExist(cacheFilename) {
-			return cacheFilename, nil
-		}
+// ReadLabels reads MNIST labels from r which may be gzip compressed
+func ReadLabels(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	return MNIST.format().readLabels(ctx, r)
+}
 
-		log.Printf("downloading %s to %s", filename, cacheFilename)
-		resp, err := http.Get(filename)
-		if err != nil {
-			return "", err
-		}
-		defer resp.Body.Close()
-		out, err := os.Create(cacheFilename)
-		if err != nil {
-			return "", err
-		}
-		defer out.Close()
-		if n, err := io.Copy(out, resp.Body); err != nil {
-			return "", err
-		} else {
-			log.Printf("%s downloaded, total %d bytes", filename, n)
-		}
-		filename = cacheFilename
-	}
-	return filename, nil
+// Read reads MNIST images and labels
+func Read(ctx context.Context, images, labels io.Reader) ([]*Sample, error) {
+	return MNIST.format().read(ctx, images, labels)
+}
+
+// ReadDataset reads MNIST images and labels into a compact Dataset
+func ReadDataset(ctx context.Context, images, labels io.Reader) (*Dataset, error) {
+	return MNIST.format().readDataset(ctx, images, labels)
 }
 
-func readImages(filename string, result []*Sample) ([]*Sample, error) {
-	filename, err := tryDownload(filename)
+// LoadFS reads MNIST images and labels from files in fsys
+func LoadFS(ctx context.Context, fsys fs.FS, imageFile, labelFile string) ([]*Sample, error) {
+	d, err := MNIST.format().loadFS(ctx, fsys, imageFile, labelFile)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
+	return d.Samples(), nil
+}
 
-	file, err := os.Open(filename)
+func (f format) read(ctx context.Context, images, labels io.Reader) ([]*Sample, error) {
+	d, err := f.readDataset(ctx, images, labels)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	defer file.Close()
+	return d.Samples(), nil
+}
 
-	gzreader, err := gzip.NewReader(file)
+func (f format) readDataset(ctx context.Context, images, labels io.Reader) (*Dataset, error) {
+	pixels, rows, cols, err := f.decodeImages(ctx, images)
 	if err != nil {
-		return result, err
+		return nil, err
+	}
+	classes, err := f.decodeLabels(ctx, labels)
+	if err != nil {
+		return nil, err
+	}
+	if num := len(pixels) / (rows * cols); num != len(classes) {
+		return nil, fmt.Errorf("%w: %d images, %d labels", ErrCountMismatch, num, len(classes))
 	}
-	defer gzreader.Close()
+	return &Dataset{
+		Rows:       rows,
+		Cols:       cols,
+		NumClasses: f.numClasses,
+		Images:     pixels,
+		Labels:     classes,
+	}, nil
+}
 
-	reader := bufio.NewReader(gzreader)
-	// read magic number
-	if _, err = readInteger(reader); err != nil {
-		return result, err
+// readFiles reads images and labels from local files or remote URLs,
+// decoded datasets are cached by DefaultBinaryCache
+func (f format) readFiles(ctx context.Context, imageFile, labelFile string) (*Dataset, error) {
+	imageFile, err := tryDownload(ctx, imageFile, f.checksum(imageFile))
+	if err != nil {
+		return nil, err
 	}
+	labelFile, err = tryDownload(ctx, labelFile, f.checksum(labelFile))
+	if err != nil {
+		return nil, err
+	}
+	return DefaultBinaryCache.load(f, imageFile, labelFile, func() (*Dataset, error) {
+		return f.decodeFiles(ctx, imageFile, labelFile)
+	})
+}
 
-	// read number of items
-	num, err := readInteger(reader)
+// decodeFiles decodes images and labels from local files
+func (f format) decodeFiles(ctx context.Context, imageFile, labelFile string) (*Dataset, error) {
+	images, err := os.Open(imageFile)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
+	defer images.Close()
+	labels, err := os.Open(labelFile)
+	if err != nil {
+		return nil, err
+	}
+	defer labels.Close()
+	return f.readDataset(ctx, namedReader{imageFile, images}, namedReader{labelFile, labels})
+}
 
-	// read rowSize
-	rowSize, err := readInteger(reader)
+func (f format) loadFS(ctx context.Context, fsys fs.FS, imageFile, labelFile string) (*Dataset, error) {
+	images, err := fsys.Open(imageFile)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	// read colSize
-	colSize, err := readInteger(reader)
+	defer images.Close()
+	labels, err := fsys.Open(labelFile)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
+	defer labels.Close()
+	return f.readDataset(ctx, namedReader{imageFile, images}, namedReader{labelFile, labels})
+}
+
+// namedReader prefixes errors returned by readImages and readLabels with the name
+type namedReader struct {
+	name string
+	io.Reader
+}
 
-	if len(result) == 0 {
-		result = make([]*Sample, num)
+func withName(r io.Reader, err error) error {
+	if nr, ok := r.(namedReader); ok {
+		return fmt.Errorf("%s: %w", nr.name, err)
 	}
+	return err
+}
 
-	// read items
-	var b byte
-	for i := int32(0); i < num; i++ {
-		vec := mathx.NewMatrix(int(rowSize*colSize), 1)
-		for j := int32(0); j < rowSize; j++ {
-			for k := int32(0); k < colSize; k++ {
-				b, err = reader.ReadByte()
-				if err != nil {
-					return result, err
-				}
-				vec.Set(int(j*colSize+k), 0, mathx.Float(b)/255)
-			}
+// contextReader fails reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Validate checks that every sample has an input and a label and that all
+// inputs and all labels are column vectors of the same size.
+func Validate(set []*Sample) error {
+	var first *Sample
+	for i, s := range set {
+		if s == nil {
+			return fmt.Errorf("sample %d: %w: nil sample", i, ErrShape)
+		}
+		if s.Input == nil || s.Label == nil {
+			return fmt.Errorf("sample %d: %w: nil input or label", i, ErrShape)
+		}
+		if s.Input.ColCount() != 1 || s.Label.ColCount() != 1 {
+			return fmt.Errorf("sample %d: %w: input %dx%d and label %dx%d must be column vectors", i, ErrShape,
+				s.Input.RowCount(), s.Input.ColCount(), s.Label.RowCount(), s.Label.ColCount())
 		}
-		if result[i] == nil {
-			result[i] = new(Sample)
+		if first == nil {
+			first = s
+			continue
+		}
+		if s.Input.RowCount() != first.Input.RowCount() {
+			return fmt.Errorf("sample %d: %w: input size %d, want %d", i, ErrShape, s.Input.RowCount(), first.Input.RowCount())
+		}
+		if s.Label.RowCount() != first.Label.RowCount() {
+			return fmt.Errorf("sample %d: %w: label size %d, want %d", i, ErrShape, s.Label.RowCount(), first.Label.RowCount())
 		}
-		result[i].Input = vec
 	}
-	return result, nil
+	return nil
 }
 
-func readLabels(filename string, result []*Sample) ([]*Sample, error) {
-	filename, err := tryDownload(filename)
-	if err != nil {
-		return result, err
+func SplitTrainingSet(set []*Sample) (trainingdata, validationset []*Sample) {
+	n := 5 * len(set) / 6
+	return set[:n], set[n:]
+}
+
+func joinFilename(path, filename string) string {
+	if isRemote(path) {
+		if strings.HasSuffix(path, "/") {
+			return path + filename
+		}
+		return path + "/" + filename
 	}
-	file, err := os.Open(filename)
-	if err != nil {
-		return result, err
+	return filepath.Join(path, filename)
+}
+
+func tryDownload(ctx context.Context, filename, checksum string) (string, error) {
+	if isRemote(filename) {
+		return DefaultDownloader.Fetch(ctx, filename, checksum)
 	}
+	return filename, nil
+}
 
-	gzreader, err := gzip.NewReader(file)
+func (f format) readImages(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	pixels, rows, cols, err := f.decodeImages(ctx, r)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	defer gzreader.Close()
-
-	reader := bufio.NewReader(gzreader)
-	// read magic number
-	if _, err := readInteger(reader); err != nil {
-		return result, err
+	size := rows * cols
+	result := make([]*mathx.Matrix, len(pixels)/size)
+	for i := range result {
+		result[i] = toInput(pixels[i*size : (i+1)*size])
 	}
+	return result, nil
+}
 
-	// read number of items
-	num, err := readInteger(reader)
+func (f format) readLabels(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	classes, err := f.decodeLabels(ctx, r)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-
-	if len(result) == 0 {
-		result = make([]*Sample, num)
+	result := make([]*mathx.Matrix, len(classes))
+	for i, label := range classes {
+		result[i] = toLabel(int(label), f.numClasses)
 	}
+	return result, nil
+}
 
-	// read items
-	for i := int32(0); i < num; i++ {
-		b, err := reader.ReadByte()
-		if err != nil {
-			return result, err
-		}
-		if b < 0 || b > 9 {
-			return result, ErrLabel
-		}
-		vec := mathx.NewMatrix(10, 1)
-		vec.Set(int(b), 0, 1)
-		if result[i] == nil {
-			result[i] = new(Sample)
+// decodeImages reads images as row-major pixels
+func (f format) decodeImages(ctx context.Context, r io.Reader) (pixels []uint8, rows, cols int, err error) {
+	t, err := idx.Read(contextReader{ctx, r})
+	if err != nil {
+		return nil, 0, 0, withName(r, err)
+	}
+	if t.Type != idx.Uint8 || len(t.Dims) != 3 {
+		return nil, 0, 0, withName(r, fmt.Errorf("%w: want uint8 images with 3 dimensions, got %v with dimensions %v", ErrFormat, t.Type, t.Dims))
+	}
+	rows, cols = t.Dims[1], t.Dims[2]
+	size := rows * cols
+	if size == 0 {
+		return nil, 0, 0, withName(r, fmt.Errorf("%w: image size %dx%d", ErrShape, rows, cols))
+	}
+	pixels = t.Data.([]uint8)
+	if f.transposed {
+		// stored column by column
+		buf := make([]uint8, size)
+		for i := 0; i < len(pixels); i += size {
+			image := pixels[i : i+size]
+			for j, b := range image {
+				buf[j%rows*cols+j/rows] = b
+			}
+			copy(image, buf)
 		}
-		result[i].Label = vec
 	}
-	return result, nil
+	return pixels, rows, cols, nil
 }
 
-func readInteger(reader io.Reader) (value int32, err error) {
-	err = binary.Read(reader, binary.BigEndian, &value)
-	return
+// decodeLabels reads labels as class indices
+func (f format) decodeLabels(ctx context.Context, r io.Reader) ([]uint8, error) {
+	t, err := idx.Read(contextReader{ctx, r})
+	if err != nil {
+		return nil, withName(r, err)
+	}
+	if t.Type != idx.Uint8 || len(t.Dims) != 1 {
+		return nil, withName(r, fmt.Errorf("%w: want uint8 labels with 1 dimension, got %v with dimensions %v", ErrFormat, t.Type, t.Dims))
+	}
+	labels := t.Data.([]uint8)
+	for i, b := range labels {
+		label := int(b) - f.labelOffset
+		if label < 0 || label >= f.numClasses {
+			return nil, withName(r, fmt.Errorf("%w: label %d of sample %d out of range [%d, %d)", ErrLabel, b, i, f.labelOffset, f.labelOffset+f.numClasses))
+		}
+		labels[i] = uint8(label)
+	}
+	return labels, nil
 }
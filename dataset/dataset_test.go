@@ -0,0 +1,152 @@
+package dataset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mkideal/mnist/dataset/idx"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFiles(t *testing.T, numImages, numLabels int) (imageFile, labelFile string) {
+	dir := t.TempDir()
+	imageFile = filepath.Join(dir, "images-idx3-ubyte.gz")
+	labelFile = filepath.Join(dir, "labels-idx1-ubyte.gz")
+	images := idx.NewTensor(idx.Uint8, numImages, 2, 2)
+	for i := 0; i < images.Len(); i++ {
+		images.SetAt(i, float64(i%256))
+	}
+	labels := idx.NewTensor(idx.Uint8, numLabels)
+	for i := 0; i < labels.Len(); i++ {
+		labels.SetAt(i, float64(i%10))
+	}
+	assert.NoError(t, idx.WriteFile(imageFile, images))
+	assert.NoError(t, idx.WriteFile(labelFile, labels))
+	return
+}
+
+func TestReadTrainingSet(t *testing.T) {
+	imageFile, labelFile := writeTestFiles(t, 12, 12)
+	set, err := ReadTrainingSet(imageFile, labelFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 12, len(set))
+		assert.Equal(t, 4, set[1].Input.RowCount())
+		assert.Equal(t, mathx.Float(4)/255, set[1].Input.Get(0, 0))
+		i, _, _ := set[3].Label.MaxElem()
+		assert.Equal(t, 3, i)
+	}
+
+	imageFile, labelFile = writeTestFiles(t, 12, 11)
+	_, err = ReadTrainingSet(imageFile, labelFile)
+	assert.True(t, errors.Is(err, ErrCountMismatch), "got %v", err)
+}
+
+func TestValidate(t *testing.T) {
+	sample := func(inputSize, labelSize int) *Sample {
+		return &Sample{Input: mathx.NewMatrix(inputSize, 1), Label: mathx.NewMatrix(labelSize, 1)}
+	}
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate([]*Sample{sample(4, 10), sample(4, 10)}))
+	for _, set := range [][]*Sample{
+		{sample(4, 10), nil},
+		{sample(4, 10), {Input: mathx.NewMatrix(4, 1)}},
+		{sample(4, 10), sample(5, 10)},
+		{sample(4, 10), sample(4, 9)},
+		{{Input: mathx.NewMatrix(1, 4), Label: mathx.NewMatrix(10, 1)}},
+	} {
+		assert.True(t, errors.Is(Validate(set), ErrShape))
+	}
+}
+
+func TestReadFormat(t *testing.T) {
+	imageFile, labelFile := writeTestFiles(t, 12, 12)
+	ctx := context.Background()
+	_, err := format{numClasses: 9, labelOffset: 1, transposed: true}.readFiles(ctx, imageFile, labelFile)
+	assert.True(t, errors.Is(err, ErrLabel), "got %v", err)
+
+	d, err := format{numClasses: 11, labelOffset: -1, transposed: true}.readFiles(ctx, imageFile, labelFile)
+	if assert.NoError(t, err) {
+		set := d.Samples()
+		assert.Equal(t, 11, set[0].Label.RowCount())
+		i, _, _ := set[3].Label.MaxElem()
+		assert.Equal(t, 4, i)
+		// stored pixels 4 5 6 7 are column-major
+		assert.Equal(t, []mathx.Float{4, 6, 5, 7}, set[1].Input.Scale(255).Slice())
+	}
+}
+
+func TestDataset(t *testing.T) {
+	imageFile, labelFile := writeTestFiles(t, 12, 12)
+	d, err := MNIST.format().readFiles(context.Background(), imageFile, labelFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 12, d.Len())
+	assert.Equal(t, 4, d.ImageSize())
+	assert.Equal(t, []uint8{4, 5, 6, 7}, d.Image(1))
+	assert.Equal(t, 3, d.Label(3))
+
+	inputs, labels := d.Batch([]int{3, 1})
+	assert.Equal(t, 4, inputs.RowCount())
+	assert.Equal(t, 2, inputs.ColCount())
+	assert.True(t, d.Input(1).Equal(inputs.Col(1)))
+	assert.Equal(t, mathx.Float(1), labels.Get(3, 0))
+	assert.Equal(t, mathx.Float(1), labels.Get(1, 1))
+
+	sub := d.Subset([]int{5, 2})
+	assert.Equal(t, []uint8{5, 2}, sub.Labels)
+	assert.Equal(t, d.Image(5), sub.Image(0))
+	assert.Equal(t, d.Labels[2:4], d.Slice(2, 4).Labels)
+
+	d2, err := NewDataset(d.Samples(), 2, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d, d2)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, name := range Names() {
+		info, ok := Lookup(name)
+		if assert.True(t, ok) {
+			assert.Equal(t, name, info.Name)
+			assert.Equal(t, info.NumClasses, len(info.ClassNames), name)
+		}
+	}
+	assert.Equal(t, 47, EMNISTBalanced.NumClasses)
+	assert.Equal(t, 26, EMNISTLetters.NumClasses)
+	assert.Equal(t, 62, EMNISTByClass.NumClasses)
+	assert.Panics(t, func() { Register(&Info{Name: MNIST.Name}) })
+}
+
+func TestLoadFS(t *testing.T) {
+	var images, labels bytes.Buffer
+	imageTensor := idx.NewTensor(idx.Uint8, 3, 2, 2)
+	labelTensor := idx.NewTensor(idx.Uint8, 3)
+	assert.NoError(t, idx.Write(&images, imageTensor))
+	gzwriter := gzip.NewWriter(&labels)
+	assert.NoError(t, idx.Write(gzwriter, labelTensor))
+	assert.NoError(t, gzwriter.Close())
+
+	fsys := fstest.MapFS{
+		"images": {Data: images.Bytes()},
+		"labels": {Data: labels.Bytes()},
+	}
+	set, err := LoadFS(context.Background(), fsys, "images", "labels")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, len(set))
+	}
+
+	_, err = LoadFS(context.Background(), fsys, "labels", "labels")
+	assert.True(t, errors.Is(err, ErrFormat), "got %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Read(ctx, bytes.NewReader(images.Bytes()), bytes.NewReader(labels.Bytes()))
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+}
@@ -0,0 +1,252 @@
+package dataset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksum = errors.New("checksum mismatch")
+	ErrOffline  = errors.New("file not cached in offline mode")
+)
+
+// CacheDirEnv is the environment variable which overrides the default cache directory
+const CacheDirEnv = "MNIST_CACHE_DIR"
+
+// StatusError is returned when a download gets an unexpected HTTP status
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("download %s: unexpected status %s", e.URL, e.Status)
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Downloader downloads remote files into a local cache directory.
+//
+// A file is downloaded to a temporary ".part" file which is renamed to the
+// cached file after its checksum is verified, so the cache never contains
+// truncated files. An interrupted download is resumed by HTTP Range request.
+type Downloader struct {
+	// Client is used to send requests, http.DefaultClient used if nil
+	Client *http.Client
+	// CacheDir is the cache directory, DefaultCacheDir() used if empty
+	CacheDir string
+	// Offline disables downloading, Fetch fails if the file is not cached
+	Offline bool
+	// Retries is the max number of retries after the first attempt failed
+	Retries int
+	// Backoff is the delay before the first retry, it's doubled after each retry
+	Backoff time.Duration
+}
+
+// DefaultDownloader is used to download remote dataset files
+var DefaultDownloader = &Downloader{
+	Retries: 3,
+	Backoff: time.Second,
+}
+
+func isRemote(filename string) bool {
+	return strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://")
+}
+
+func (d *Downloader) client() *http.Client {
+	if d.Client != nil {
+		return d.Client
+	}
+	return http.DefaultClient
+}
+
+// DefaultCacheDir returns $MNIST_CACHE_DIR if set, otherwise the mnist
+// directory in the user cache directory.
+func DefaultCacheDir() string {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(".cache", "mnist")
+	}
+	return filepath.Join(cacheDir, "mnist")
+}
+
+// Dir returns the cache directory
+func (d *Downloader) Dir() string {
+	if d.CacheDir != "" {
+		return d.CacheDir
+	}
+	return DefaultCacheDir()
+}
+
+// CacheFilename returns the local filename of rawurl in cache directory.
+// Host and path are kept so that datasets with the same file names don't collide.
+func (d *Downloader) CacheFilename(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.Dir(), u.Host, filepath.FromSlash(path.Clean("/"+u.Path))), nil
+}
+
+// Fetch downloads rawurl unless it's already cached and returns the cached
+// filename. The file is verified if checksum, a hex encoded SHA-256, is not empty.
+func (d *Downloader) Fetch(ctx context.Context, rawurl, checksum string) (string, error) {
+	cacheFilename, err := d.CacheFilename(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(cacheFilename); err == nil {
+		if err := verifyFile(cacheFilename, checksum); err == nil {
+			return cacheFilename, nil
+		} else if !errors.Is(err, ErrChecksum) {
+			return "", err
+		}
+		log.Printf("%s: checksum mismatch, downloading again", cacheFilename)
+		if err := os.Remove(cacheFilename); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if d.Offline {
+		return "", fmt.Errorf("%s: %w", rawurl, ErrOffline)
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFilename), 0755); err != nil {
+		return "", err
+	}
+
+	log.Printf("downloading %s to %s", rawurl, cacheFilename)
+	tmpFilename := cacheFilename + ".part"
+	if checksum == "" {
+		// a partial file may be left by a different version of the file,
+		// it's only resumed if the result can be verified
+		if err := os.Remove(tmpFilename); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	backoff := d.Backoff
+	for i := 0; ; i++ {
+		if err = d.download(ctx, rawurl, tmpFilename); err == nil {
+			if err = verifyFile(tmpFilename, checksum); err == nil {
+				break
+			}
+			// the partial file is corrupted, start over
+			os.Remove(tmpFilename)
+		}
+		var statusErr *StatusError
+		if i >= d.Retries || ctx.Err() != nil || (errors.As(err, &statusErr) && !statusErr.Temporary()) {
+			return "", err
+		}
+		log.Printf("download %s failed: %v, retry after %v", rawurl, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		backoff *= 2
+	}
+	if err := os.Rename(tmpFilename, cacheFilename); err != nil {
+		return "", err
+	}
+	return cacheFilename, nil
+}
+
+// download downloads rawurl to filename, it resumes from the end of filename if it exists
+func (d *Downloader) download(ctx context.Context, rawurl, filename string) error {
+	var offset int64
+	if info, err := os.Stat(filename); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// server ignored Range header
+		offset = 0
+		flag |= os.O_TRUNC
+	case http.StatusPartialContent:
+		flag |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 {
+			// the partial file is already complete
+			return nil
+		}
+		fallthrough
+	default:
+		return &StatusError{URL: rawurl, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	out, err := os.OpenFile(filename, flag, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%s downloaded, total %d bytes", rawurl, offset+n)
+	return nil
+}
+
+// verifyFile verifies SHA-256 of filename, it does nothing if checksum is empty
+func verifyFile(filename, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	sum, err := fileChecksum(filename)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("%s: %w: got %s, want %s", filename, ErrChecksum, sum, checksum)
+	}
+	return nil
+}
+
+// fileChecksum returns hex encoded SHA-256 of filename
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
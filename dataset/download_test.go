@@ -0,0 +1,175 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloaderFetch(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/data.gz":
+			if n == 1 {
+				// interrupt the first request half way
+				w.Header().Set("Content-Length", "10000")
+				w.Write(content[:5000])
+				return
+			}
+			if n == 2 {
+				assert.Equal(t, "bytes=5000-", r.Header.Get("Range"))
+			}
+			http.ServeContent(w, r, "data.gz", time.Time{}, bytes.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	d := &Downloader{Client: server.Client(), CacheDir: t.TempDir(), Retries: 2, Backoff: time.Millisecond}
+	filename, err := d.Fetch(ctx, server.URL+"/data.gz", checksum)
+	if assert.NoError(t, err) {
+		data, err := os.ReadFile(filename)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		_, err = os.Stat(filename + ".part")
+		assert.True(t, os.IsNotExist(err))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// cached
+	_, err = d.Fetch(ctx, server.URL+"/data.gz", checksum)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// not found is not retried and not cached
+	atomic.StoreInt32(&requests, 10)
+	_, err = d.Fetch(ctx, server.URL+"/missing.gz", "")
+	var statusErr *StatusError
+	if assert.True(t, errors.As(err, &statusErr)) {
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	}
+	assert.Equal(t, int32(11), atomic.LoadInt32(&requests))
+	missing, _ := d.CacheFilename(server.URL + "/missing.gz")
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err))
+
+	// checksum mismatch
+	_, err = d.Fetch(ctx, server.URL+"/data.gz?v=2", "00")
+	assert.True(t, errors.Is(err, ErrChecksum), "got %v", err)
+}
+
+func TestDownloaderCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// partial files of unverifiable downloads are never resumed
+		assert.Empty(t, r.Header.Get("Range"))
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	d := &Downloader{Client: server.Client(), CacheDir: t.TempDir(), Offline: true}
+	_, err := d.Fetch(ctx, server.URL+"/a.gz", "")
+	assert.True(t, errors.Is(err, ErrOffline))
+
+	d.Offline = false
+	filename, err := d.CacheFilename(server.URL + "/a.gz")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	assert.NoError(t, os.WriteFile(filename+".part", []byte("stale"), 0644))
+	filename, err = d.Fetch(ctx, server.URL+"/a.gz", "")
+	assert.NoError(t, err)
+	entries, err := d.List()
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, filename, entries[0].Filename)
+		assert.Equal(t, int64(4), entries[0].Size)
+		assert.True(t, errors.Is(entries[0].Verify(), ErrUnknownChecksum))
+	}
+
+	d.Offline = true
+	_, err = d.Fetch(ctx, server.URL+"/a.gz", "")
+	assert.NoError(t, err)
+
+	// only files owned by the cache are cleaned
+	known, err := d.CacheFilename(joinFilename(MNIST.URL, MNIST.TrainingImages))
+	assert.NoError(t, err)
+	binFile := filepath.Join(d.Dir(), "bin", "x.bin")
+	for _, name := range []string{known, known + ".part", binFile} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte("data"), 0644))
+	}
+	assert.Error(t, d.Clean("unknown"))
+	assert.NoError(t, d.Clean(MNIST.Name))
+	assert.NoFileExists(t, known)
+	assert.NoFileExists(t, known+".part")
+	assert.FileExists(t, binFile)
+	assert.NoError(t, d.Clean())
+	entries, err = d.List()
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, filename, entries[0].Filename)
+	}
+	assert.NoDirExists(t, filepath.Dir(binFile))
+}
+
+func TestCacheMirror(t *testing.T) {
+	sum := sha256.Sum256([]byte("kmnist"))
+	checksum := KMNIST.Checksums[KMNIST.TrainingImages]
+	KMNIST.Checksums[KMNIST.TrainingImages] = hex.EncodeToString(sum[:])
+	t.Cleanup(func() { KMNIST.Checksums[KMNIST.TrainingImages] = checksum })
+
+	// files downloaded from a mirror are matched by name and checksum
+	d := &Downloader{CacheDir: t.TempDir()}
+	mirror := filepath.Join(d.Dir(), "mirror.example.com", "data")
+	files := map[string]string{
+		KMNIST.TrainingImages:                  "kmnist",
+		KMNIST.TrainingLabels:                  "unknown",
+		EMNISTLetters.TrainingImages:           "emnist",
+		EMNISTLetters.TrainingLabels + ".part": "partial",
+		KMNIST.TestImages + ".part":            "partial",
+		"other.gz":                             "other",
+	}
+	assert.NoError(t, os.MkdirAll(mirror, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(mirror, name), []byte(content), 0644))
+	}
+	entries, err := d.List()
+	if assert.NoError(t, err) {
+		datasets := make(map[string]string)
+		for _, entry := range entries {
+			datasets[filepath.Base(entry.Filename)] = entry.Dataset
+		}
+		assert.Equal(t, map[string]string{
+			KMNIST.TrainingImages:                  KMNIST.Name,
+			KMNIST.TrainingLabels:                  "",
+			EMNISTLetters.TrainingImages:           EMNISTLetters.Name,
+			EMNISTLetters.TrainingLabels + ".part": EMNISTLetters.Name,
+			KMNIST.TestImages + ".part":            "",
+			"other.gz":                             "",
+		}, datasets)
+	}
+
+	assert.NoError(t, d.Clean())
+	entries, err = d.List()
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, filepath.Join(mirror, "other.gz"), entries[0].Filename)
+		assert.Equal(t, filepath.Join(mirror, KMNIST.TrainingLabels), entries[1].Filename)
+	}
+}
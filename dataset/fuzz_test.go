@@ -0,0 +1,80 @@
+package dataset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/mkideal/mnist/dataset/idx"
+)
+
+func encodeIDX(f *testing.F, t *idx.Tensor, compress bool) []byte {
+	var buf bytes.Buffer
+	if !compress {
+		if err := idx.Write(&buf, t); err != nil {
+			f.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	w := gzip.NewWriter(&buf)
+	if err := idx.Write(w, t); err != nil {
+		f.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		f.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzReadImages(f *testing.F) {
+	images := idx.NewTensor(idx.Uint8, 3, 2, 2)
+	for i := 0; i < images.Len(); i++ {
+		images.SetAt(i, float64(i*20))
+	}
+	f.Add(encodeIDX(f, images, false))
+	f.Add(encodeIDX(f, images, true))
+	f.Add(encodeIDX(f, idx.NewTensor(idx.Uint8, 0, 28, 28), false))
+	f.Add([]byte{0, 0, 8, 3, 0x7F, 0xFF, 0xFF, 0xFF, 0, 0, 0, 28, 0, 0, 0, 28})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		inputs, err := ReadImages(context.Background(), bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for i, input := range inputs {
+			if input.RowCount() != inputs[0].RowCount() || input.ColCount() != 1 {
+				t.Fatalf("image %d: shape %dx%d", i, input.RowCount(), input.ColCount())
+			}
+			for _, x := range input.Slice() {
+				if x < 0 || x > 1 {
+					t.Fatalf("image %d: pixel %v out of range", i, x)
+				}
+			}
+		}
+	})
+}
+
+func FuzzReadLabels(f *testing.F) {
+	labels := idx.NewTensor(idx.Uint8, 12)
+	for i := 0; i < labels.Len(); i++ {
+		labels.SetAt(i, float64(i%10))
+	}
+	f.Add(encodeIDX(f, labels, false))
+	f.Add(encodeIDX(f, labels, true))
+	f.Add([]byte{0, 0, 8, 1, 0, 0, 0, 1, 10})
+	f.Add([]byte{0, 0, 8, 1, 0x7F, 0xFF, 0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		classes, err := ReadLabels(context.Background(), bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for i, label := range classes {
+			if label.RowCount() != 10 || label.ColCount() != 1 {
+				t.Fatalf("label %d: shape %dx%d", i, label.RowCount(), label.ColCount())
+			}
+			if _, _, max := label.MaxElem(); max != 1 {
+				t.Fatalf("label %d isn't one-hot", i)
+			}
+		}
+	})
+}
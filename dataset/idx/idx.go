@@ -0,0 +1,266 @@
+// Package idx implements reading and writing of the IDX file format used by
+// the MNIST database.
+//
+// @see http://yann.lecun.com/exdb/mnist/
+//
+// An IDX file starts with a magic number: two zero bytes, a byte which
+// describes the data type and a byte which is the number of dimensions.
+// The magic number is followed by the size of each dimension as a big
+// endian int32 and then the data itself in row-major order.
+package idx
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+var (
+	ErrMagic     = errors.New("idx: bad magic number")
+	ErrDataType  = errors.New("idx: unknown data type")
+	ErrDims      = errors.New("idx: bad dimensions")
+	ErrTruncated = errors.New("idx: truncated data")
+	ErrTrailing  = errors.New("idx: trailing data")
+	ErrLimit     = errors.New("idx: limit exceeded")
+)
+
+// Limits bound resources used to read IDX streams from untrusted sources
+type Limits struct {
+	// MaxDims is the max number of dimensions
+	MaxDims int
+	// MaxBytes is the max size of data declared by the header, it also limits
+	// decompressed size of gzip streams
+	MaxBytes int64
+}
+
+// DefaultLimits are used by Read, they allow the largest public IDX datasets
+var DefaultLimits = Limits{MaxDims: 16, MaxBytes: 1 << 30}
+
+// check returns size of data declared by h in bytes
+func (l Limits) check(h Header) (int64, error) {
+	if len(h.Dims) > l.MaxDims {
+		return 0, fmt.Errorf("%w: %d dimensions, at most %d allowed", ErrLimit, len(h.Dims), l.MaxDims)
+	}
+	n := int64(h.Type.Size())
+	for _, d := range h.Dims {
+		// checked before multiplying so that n never overflows
+		if d != 0 && n > l.MaxBytes/int64(d) {
+			return 0, fmt.Errorf("%w: dimensions %v of %v exceed %d bytes", ErrLimit, h.Dims, h.Type, l.MaxBytes)
+		}
+		n *= int64(d)
+	}
+	return n, nil
+}
+
+// DataType is the type of elements stored in an IDX file
+type DataType byte
+
+const (
+	Uint8   DataType = 0x08
+	Int8    DataType = 0x09
+	Int16   DataType = 0x0B
+	Int32   DataType = 0x0C
+	Float32 DataType = 0x0D
+	Float64 DataType = 0x0E
+)
+
+func (t DataType) Valid() bool {
+	return t.Size() > 0
+}
+
+// Size returns number of bytes of an element, 0 returned if t is invalid
+func (t DataType) Size() int {
+	switch t {
+	case Uint8, Int8:
+		return 1
+	case Int16:
+		return 2
+	case Int32, Float32:
+		return 4
+	case Float64:
+		return 8
+	}
+	return 0
+}
+
+func (t DataType) String() string {
+	switch t {
+	case Uint8:
+		return "uint8"
+	case Int8:
+		return "int8"
+	case Int16:
+		return "int16"
+	case Int32:
+		return "int32"
+	case Float32:
+		return "float32"
+	case Float64:
+		return "float64"
+	}
+	return fmt.Sprintf("DataType(0x%02X)", byte(t))
+}
+
+// Header is the header of an IDX file
+type Header struct {
+	Type DataType
+	Dims []int
+}
+
+// NumElems returns number of elements described by the header
+func (h Header) NumElems() int {
+	n := 1
+	for _, d := range h.Dims {
+		n *= d
+	}
+	return n
+}
+
+// ReadHeader reads and validates magic number and dimensions
+func ReadHeader(r io.Reader) (Header, error) {
+	var h Header
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return h, readError(err, "reading magic number")
+	}
+	if magic[0] != 0 || magic[1] != 0 {
+		return h, fmt.Errorf("%w: %02X%02X%02X%02X", ErrMagic, magic[0], magic[1], magic[2], magic[3])
+	}
+	h.Type = DataType(magic[2])
+	if !h.Type.Valid() {
+		return h, fmt.Errorf("%w: 0x%02X", ErrDataType, magic[2])
+	}
+	h.Dims = make([]int, magic[3])
+	for i := range h.Dims {
+		var d int32
+		if err := binary.Read(r, binary.BigEndian, &d); err != nil {
+			return h, readError(err, fmt.Sprintf("reading size of dimension %d", i))
+		}
+		if d < 0 {
+			return h, fmt.Errorf("%w: dimension %d has negative size %d", ErrDims, i, d)
+		}
+		h.Dims[i] = int(d)
+	}
+	return h, nil
+}
+
+// readError reports unexpected EOF as ErrTruncated and wraps other errors
+func readError(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %s: %v", ErrTruncated, what, err)
+	}
+	return fmt.Errorf("idx: %s: %w", what, err)
+}
+
+// WriteHeader writes magic number and dimensions of h
+func WriteHeader(w io.Writer, h Header) error {
+	if !h.Type.Valid() {
+		return fmt.Errorf("%w: 0x%02X", ErrDataType, byte(h.Type))
+	}
+	if len(h.Dims) > math.MaxUint8 {
+		return fmt.Errorf("%w: too many dimensions: %d", ErrDims, len(h.Dims))
+	}
+	if _, err := w.Write([]byte{0, 0, byte(h.Type), byte(len(h.Dims))}); err != nil {
+		return err
+	}
+	for i, d := range h.Dims {
+		if d < 0 || d > math.MaxInt32 {
+			return fmt.Errorf("%w: dimension %d has invalid size %d", ErrDims, i, d)
+		}
+		if err := binary.Write(w, binary.BigEndian, int32(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads an IDX stream with DefaultLimits, gzip compressed stream is
+// detected by its magic bytes and decompressed.
+func Read(r io.Reader) (*Tensor, error) {
+	return ReadLimited(r, DefaultLimits)
+}
+
+// ReadLimited is like Read but fails with ErrLimit if the header exceeds
+// limits. Memory is allocated as data arrives rather than as declared by the
+// header, and the stream must end right after the declared data.
+func ReadLimited(r io.Reader, limits Limits) (*Tensor, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzreader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gzreader.Close()
+		br = bufio.NewReader(gzreader)
+	}
+	h, err := ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	size, err := limits.check(h)
+	if err != nil {
+		return nil, err
+	}
+	return readTensor(br, h, size)
+}
+
+// Write writes t as an uncompressed IDX stream
+func Write(w io.Writer, t *Tensor) error {
+	bw := bufio.NewWriter(w)
+	if err := WriteHeader(bw, Header{Type: t.Type, Dims: t.Dims}); err != nil {
+		return err
+	}
+	if err := t.writeData(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadFile reads an IDX file which may be gzip compressed
+func ReadFile(filename string) (*Tensor, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return t, nil
+}
+
+// WriteFile writes t to an IDX file, the file is compressed if its name ends with ".gz"
+func WriteFile(filename string, t *Tensor) error {
+	return CreateFile(filename, func(w io.Writer) error { return Write(w, t) })
+}
+
+// CreateFile creates filename and calls write with it, the content is gzip
+// compressed if filename ends with ".gz"
+func CreateFile(filename string, write func(io.Writer) error) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if !strings.HasSuffix(filename, ".gz") {
+		return write(file)
+	}
+	gzwriter := gzip.NewWriter(file)
+	if err := write(gzwriter); err != nil {
+		return err
+	}
+	return gzwriter.Close()
+}
@@ -0,0 +1,150 @@
+package idx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWrite(t *testing.T) {
+	for _, typ := range []DataType{Uint8, Int8, Int16, Int32, Float32, Float64} {
+		tensor := NewTensor(typ, 2, 3)
+		for i := 0; i < tensor.Len(); i++ {
+			tensor.SetAt(i, float64(i*7-10))
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, Write(&buf, tensor))
+		assert.Equal(t, 4+2*4+6*typ.Size(), buf.Len())
+
+		got, err := Read(&buf)
+		if assert.NoError(t, err, typ.String()) {
+			assert.Equal(t, tensor, got)
+		}
+	}
+}
+
+func TestReadWriteFile(t *testing.T) {
+	tensor := NewTensor(Uint8, 3, 2, 2)
+	for i := 0; i < tensor.Len(); i++ {
+		tensor.SetAt(i, float64(i))
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"images-idx3-ubyte", "images-idx3-ubyte.gz"} {
+		filename := filepath.Join(dir, name)
+		assert.NoError(t, WriteFile(filename, tensor))
+		got, err := ReadFile(filename)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tensor, got)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{0, 0}, ErrTruncated},
+		{[]byte{1, 0, 8, 1, 0, 0, 0, 0}, ErrMagic},
+		{[]byte{0, 0, 0x0A, 1, 0, 0, 0, 0}, ErrDataType},
+		{[]byte{0, 0, 8, 2, 0, 0, 0, 1}, ErrTruncated},
+		{[]byte{0, 0, 8, 1, 0xFF, 0xFF, 0xFF, 0xFF}, ErrDims},
+		{[]byte{0, 0, 8, 1, 0, 0, 0, 3, 1, 2}, ErrTruncated},
+		{[]byte{0, 0, 8, 1, 0, 0, 0, 1, 1, 2}, ErrTrailing},
+		{append([]byte{0, 0, 8, 17}, bytes.Repeat([]byte{0, 0, 0, 1}, 17)...), ErrLimit},
+		{[]byte{0, 0, 0x0E, 3, 0, 0, 0x10, 0, 0, 0, 0x10, 0, 0, 0, 0x10, 0}, ErrLimit},
+		{[]byte{0, 0, 8, 3, 0x7F, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF}, ErrLimit},
+	} {
+		_, err := Read(bytes.NewReader(tc.data))
+		assert.True(t, errors.Is(err, tc.err), "%v: got %v, want %v", tc.data, err, tc.err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	tensor := NewTensor(Uint8, 2)
+	tensor.Dims = []int{3}
+	assert.True(t, errors.Is(Write(&buf, tensor), ErrDims))
+	tensor = &Tensor{Type: Uint8, Dims: []int{1}, Data: []int8{1}}
+	assert.True(t, errors.Is(Write(&buf, tensor), ErrDataType))
+}
+
+func gzipData(t testing.TB, chunks ...[]byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadLimited(t *testing.T) {
+	limits := Limits{MaxDims: 4, MaxBytes: 1 << 20}
+	zeros := make([]byte, 16<<20)
+
+	// gzip bomb: a small stream declaring and containing 16MB of data
+	bomb := gzipData(t, []byte{0, 0, 8, 3, 0, 0, 0, 1, 0, 0, 0x10, 0, 0, 0, 0x10, 0}, zeros)
+	assert.True(t, len(bomb) < 100<<10)
+	_, err := ReadLimited(bytes.NewReader(bomb), limits)
+	assert.True(t, errors.Is(err, ErrLimit), "got %v", err)
+
+	// a bomb hidden after the declared data is stopped after one byte
+	_, err = ReadLimited(bytes.NewReader(gzipData(t, []byte{0, 0, 8, 1, 0, 0, 0, 2, 1, 2}, zeros)), limits)
+	assert.True(t, errors.Is(err, ErrTrailing), "got %v", err)
+
+	// corrupted checksum of gzip stream is detected
+	data := gzipData(t, []byte{0, 0, 8, 1, 0, 0, 0, 2, 1, 2})
+	data[len(data)-8] ^= 1
+	_, err = ReadLimited(bytes.NewReader(data), limits)
+	assert.Error(t, err)
+
+	tensor, err := ReadLimited(bytes.NewReader([]byte{0, 0, 8, 2, 0, 0, 0, 2, 0, 0, 0, 0}), limits)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, tensor.Len())
+	}
+}
+
+func FuzzRead(f *testing.F) {
+	for _, typ := range []DataType{Uint8, Int16, Float64} {
+		var buf bytes.Buffer
+		tensor := NewTensor(typ, 2, 3)
+		for i := 0; i < tensor.Len(); i++ {
+			tensor.SetAt(i, float64(i))
+		}
+		if err := Write(&buf, tensor); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+		f.Add(gzipData(f, buf.Bytes()))
+	}
+	f.Add([]byte{0, 0, 8, 1, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tensor, err := ReadLimited(bytes.NewReader(data), Limits{MaxDims: 8, MaxBytes: 1 << 20})
+		if err != nil {
+			return
+		}
+		if tensor.Len() != (Header{Dims: tensor.Dims}).NumElems() {
+			t.Fatalf("%d elements for dimensions %v", tensor.Len(), tensor.Dims)
+		}
+		if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+			return
+		}
+		// uncompressed streams are read exactly
+		var buf bytes.Buffer
+		if err := Write(&buf, tensor); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("encoded % x, want % x", buf.Bytes(), data)
+		}
+	})
+}
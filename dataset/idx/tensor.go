@@ -0,0 +1,204 @@
+package idx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Tensor is a multi-dimensional array read from or written to an IDX file.
+// Data holds elements in row-major order and its type depends on Type:
+//
+//	Uint8   []uint8
+//	Int8    []int8
+//	Int16   []int16
+//	Int32   []int32
+//	Float32 []float32
+//	Float64 []float64
+type Tensor struct {
+	Type DataType
+	Dims []int
+	Data interface{}
+}
+
+// NewTensor creates a zero tensor, it panics if typ is invalid
+func NewTensor(typ DataType, dims ...int) *Tensor {
+	n := Header{Dims: dims}.NumElems()
+	t := &Tensor{Type: typ, Dims: dims}
+	switch typ {
+	case Uint8:
+		t.Data = make([]uint8, n)
+	case Int8:
+		t.Data = make([]int8, n)
+	case Int16:
+		t.Data = make([]int16, n)
+	case Int32:
+		t.Data = make([]int32, n)
+	case Float32:
+		t.Data = make([]float32, n)
+	case Float64:
+		t.Data = make([]float64, n)
+	default:
+		panic(fmt.Sprintf("idx.NewTensor: invalid data type %v", typ))
+	}
+	return t
+}
+
+// Len returns number of elements
+func (t *Tensor) Len() int {
+	switch data := t.Data.(type) {
+	case []uint8:
+		return len(data)
+	case []int8:
+		return len(data)
+	case []int16:
+		return len(data)
+	case []int32:
+		return len(data)
+	case []float32:
+		return len(data)
+	case []float64:
+		return len(data)
+	}
+	return 0
+}
+
+// At returns the i-th element as float64
+func (t *Tensor) At(i int) float64 {
+	switch data := t.Data.(type) {
+	case []uint8:
+		return float64(data[i])
+	case []int8:
+		return float64(data[i])
+	case []int16:
+		return float64(data[i])
+	case []int32:
+		return float64(data[i])
+	case []float32:
+		return float64(data[i])
+	case []float64:
+		return data[i]
+	}
+	panic(fmt.Sprintf("idx.Tensor.At: unsupported data %T", t.Data))
+}
+
+// SetAt sets the i-th element, x is converted to the element type
+func (t *Tensor) SetAt(i int, x float64) {
+	switch data := t.Data.(type) {
+	case []uint8:
+		data[i] = uint8(x)
+	case []int8:
+		data[i] = int8(x)
+	case []int16:
+		data[i] = int16(x)
+	case []int32:
+		data[i] = int32(x)
+	case []float32:
+		data[i] = float32(x)
+	case []float64:
+		data[i] = x
+	default:
+		panic(fmt.Sprintf("idx.Tensor.SetAt: unsupported data %T", t.Data))
+	}
+}
+
+// readTensor reads size bytes of data described by h, the buffer grows with
+// data actually read so a forged header can't allocate more than the stream has
+func readTensor(r io.Reader, h Header, size int64) (*Tensor, error) {
+	var buf bytes.Buffer
+	if n, err := io.CopyN(&buf, r, size); err != nil {
+		return nil, readError(err, fmt.Sprintf("read %d of %d bytes", n, size))
+	}
+	// reading to the end also verifies the checksum of gzip streams
+	var b [1]byte
+	if n, err := io.ReadFull(r, b[:]); n > 0 {
+		return nil, fmt.Errorf("%w: more than %d bytes declared by dimensions %v", ErrTrailing, size, h.Dims)
+	} else if err != io.EOF {
+		return nil, readError(err, "read end of data")
+	}
+
+	t := &Tensor{Type: h.Type, Dims: h.Dims}
+	data := buf.Bytes()
+	if h.Type == Uint8 {
+		t.Data = data
+		return t, nil
+	}
+	t.Data = NewTensor(h.Type, len(data)/h.Type.Size()).Data
+	for i, k := 0, 0; k < len(data); i, k = i+1, k+h.Type.Size() {
+		t.decode(i, data[k:k+h.Type.Size()])
+	}
+	return t, nil
+}
+
+func (t *Tensor) decode(i int, b []byte) {
+	switch data := t.Data.(type) {
+	case []uint8:
+		data[i] = b[0]
+	case []int8:
+		data[i] = int8(b[0])
+	case []int16:
+		data[i] = int16(binary.BigEndian.Uint16(b))
+	case []int32:
+		data[i] = int32(binary.BigEndian.Uint32(b))
+	case []float32:
+		data[i] = math.Float32frombits(binary.BigEndian.Uint32(b))
+	case []float64:
+		data[i] = math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+}
+
+func (t *Tensor) encode(i int, b []byte) {
+	switch data := t.Data.(type) {
+	case []uint8:
+		b[0] = data[i]
+	case []int8:
+		b[0] = byte(data[i])
+	case []int16:
+		binary.BigEndian.PutUint16(b, uint16(data[i]))
+	case []int32:
+		binary.BigEndian.PutUint32(b, uint32(data[i]))
+	case []float32:
+		binary.BigEndian.PutUint32(b, math.Float32bits(data[i]))
+	case []float64:
+		binary.BigEndian.PutUint64(b, math.Float64bits(data[i]))
+	}
+}
+
+func (t *Tensor) writeData(w io.Writer) error {
+	if typ := dataType(t.Data); typ != t.Type {
+		return fmt.Errorf("%w: %T data for type %v", ErrDataType, t.Data, t.Type)
+	}
+	total := t.Len()
+	if total != (Header{Dims: t.Dims}).NumElems() {
+		return fmt.Errorf("%w: %d elements for dimensions %v", ErrDims, total, t.Dims)
+	}
+	size := t.Type.Size()
+	var buf [8]byte
+	for i := 0; i < total; i++ {
+		t.encode(i, buf[:size])
+		if _, err := w.Write(buf[:size]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dataType(data interface{}) DataType {
+	switch data.(type) {
+	case []uint8:
+		return Uint8
+	case []int8:
+		return Int8
+	case []int16:
+		return Int16
+	case []int32:
+		return Int32
+	case []float32:
+		return Float32
+	case []float64:
+		return Float64
+	}
+	return 0
+}
@@ -0,0 +1,119 @@
+package dataset
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Image is a grayscale image with pixels in range [0, 1] stored row by row
+type Image struct {
+	Rows, Cols int
+	Pix        []mathx.Float
+}
+
+func NewImage(rows, cols int) *Image {
+	return &Image{Rows: rows, Cols: cols, Pix: make([]mathx.Float, rows*cols)}
+}
+
+// ImageOf returns the i-th image of d
+func (d *Dataset) ImageOf(i int) *Image {
+	img := NewImage(d.Rows, d.Cols)
+	for j, b := range d.Image(i) {
+		img.Pix[j] = mathx.Float(b) / 255
+	}
+	return img
+}
+
+// At returns pixel at row r and column c, 0 returned if out of bounds
+func (img *Image) At(r, c int) mathx.Float {
+	if r < 0 || r >= img.Rows || c < 0 || c >= img.Cols {
+		return 0
+	}
+	return img.Pix[r*img.Cols+c]
+}
+
+// Bilinear samples the image at fractional position (y, x) by bilinear interpolation
+func (img *Image) Bilinear(y, x float64) mathx.Float {
+	y0, x0 := math.Floor(y), math.Floor(x)
+	r, c := int(y0), int(x0)
+	dy, dx := mathx.Float(y-y0), mathx.Float(x-x0)
+	return img.At(r, c)*(1-dy)*(1-dx) +
+		img.At(r, c+1)*(1-dy)*dx +
+		img.At(r+1, c)*dy*(1-dx) +
+		img.At(r+1, c+1)*dy*dx
+}
+
+// Vector returns the image as a column vector
+func (img *Image) Vector() *mathx.Matrix {
+	return mathx.NewMatrixWithColVector(append([]mathx.Float(nil), img.Pix...))
+}
+
+// Gray converts the image to an image.Gray, white digit on black background
+func (img *Image) Gray() *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, img.Cols, img.Rows))
+	for i, x := range img.Pix {
+		gray.Pix[i] = toPixel(x)
+	}
+	return gray
+}
+
+// WritePNG writes img to a PNG file
+func WritePNG(filename string, img image.Image) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return png.Encode(file, img)
+}
+
+// SampleImage returns the input of s as a rows x cols image
+func SampleImage(s *Sample, rows, cols int) *Image {
+	img := NewImage(rows, cols)
+	copy(img.Pix, s.Input.Slice())
+	return img
+}
+
+// Grid arranges images in a grid with given number of columns, separated by
+// 1 pixel gray lines. All images must have the same size.
+func Grid(images []*Image, columns int) *image.Gray {
+	if len(images) == 0 {
+		return image.NewGray(image.Rect(0, 0, 0, 0))
+	}
+	if columns <= 0 || columns > len(images) {
+		columns = len(images)
+	}
+	gridRows := (len(images) + columns - 1) / columns
+	rows, cols := images[0].Rows, images[0].Cols
+	gray := image.NewGray(image.Rect(0, 0, columns*(cols+1)-1, gridRows*(rows+1)-1))
+	for i := range gray.Pix {
+		gray.Pix[i] = 128
+	}
+	for k, img := range images {
+		x0, y0 := k%columns*(cols+1), k/columns*(rows+1)
+		for r := 0; r < rows; r++ {
+			for c := 0; c < cols; c++ {
+				gray.SetGray(x0+c, y0+r, color.Gray{Y: toPixel(img.At(r, c))})
+			}
+		}
+	}
+	return gray
+}
+
+// WriteSamplesPNG writes inputs of samples as a grid of rows x cols images to a PNG file
+func WriteSamplesPNG(filename string, samples []*Sample, rows, cols, columns int) error {
+	images := make([]*Image, len(samples))
+	for i, s := range samples {
+		images[i] = SampleImage(s, rows, cols)
+	}
+	return WritePNG(filename, Grid(images, columns))
+}
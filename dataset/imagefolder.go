@@ -0,0 +1,276 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// InvertMode decides whether a loaded image is inverted to white digit on black background
+type InvertMode int
+
+const (
+	InvertAuto   InvertMode = iota // invert if the border is brighter than the middle gray
+	InvertNever                    // image is already white on black
+	InvertAlways                   // image is black on white
+)
+
+// FolderOptions are options of ReadImageFolder and ReadImageFile
+type FolderOptions struct {
+	// Rows and Cols of output images, 28x28 if zero
+	Rows, Cols int
+	Invert     InvertMode
+	// ClassNames maps directory names to class indices, sorted directory
+	// names are used if empty
+	ClassNames []string
+}
+
+func (opts FolderOptions) size() (rows, cols int) {
+	if opts.Rows <= 0 || opts.Cols <= 0 {
+		return 28, 28
+	}
+	return opts.Rows, opts.Cols
+}
+
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// IsImageFile reports whether filename has an extension of a supported image format
+func IsImageFile(filename string) bool {
+	return imageExts[strings.ToLower(path.Ext(filename))]
+}
+
+// ReadImageFolder reads images from class-per-directory layout, e.g.
+//
+//	0/a.png
+//	0/b.png
+//	1/c.jpg
+//
+// Every image is converted to grayscale, inverted if needed and normalized like
+// MNIST: the digit is fit in a 20x20 box and centered by its center of mass in
+// a 28x28 image. It returns the dataset and class names.
+func ReadImageFolder(ctx context.Context, fsys fs.FS, opts FolderOptions) (*Dataset, []string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	sort.Strings(dirs)
+	classNames := opts.ClassNames
+	if len(classNames) == 0 {
+		classNames = dirs
+	}
+	labelOf := make(map[string]int, len(classNames))
+	for i, name := range classNames {
+		labelOf[name] = i
+	}
+	for _, dir := range dirs {
+		if _, ok := labelOf[dir]; !ok {
+			return nil, nil, fmt.Errorf("%w: unknown class directory %q", ErrLabel, dir)
+		}
+	}
+	if len(classNames) > 256 {
+		return nil, nil, fmt.Errorf("%w: too many classes: %d", ErrLabel, len(classNames))
+	}
+
+	rows, cols := opts.size()
+	d := &Dataset{Rows: rows, Cols: cols, NumClasses: len(classNames)}
+	for _, name := range dirs {
+		label := labelOf[name]
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			if entry.IsDir() || !IsImageFile(entry.Name()) {
+				continue
+			}
+			filename := path.Join(name, entry.Name())
+			img, err := readImageFS(fsys, filename, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, x := range img.Pix {
+				d.Images = append(d.Images, toPixel(x))
+			}
+			d.Labels = append(d.Labels, uint8(label))
+		}
+	}
+	return d, classNames, nil
+}
+
+// ReadImageFile reads and normalizes an image file like ReadImageFolder
+func ReadImageFile(filename string, opts FolderOptions) (*Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return NormalizeImage(src, opts), nil
+}
+
+func readImageFS(fsys fs.FS, filename string, opts FolderOptions) (*Image, error) {
+	file, err := fsys.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return NormalizeImage(src, opts), nil
+}
+
+// NormalizeImage converts src to a grayscale image normalized like MNIST
+func NormalizeImage(src image.Image, opts FolderOptions) *Image {
+	img := grayImage(src)
+	if invert := opts.Invert; invert == InvertAlways || (invert == InvertAuto && borderMean(img) > 0.5) {
+		for i, x := range img.Pix {
+			img.Pix[i] = 1 - x
+		}
+	}
+	rows, cols := opts.size()
+	return centerImage(img, rows, cols)
+}
+
+func grayImage(src image.Image) *Image {
+	bounds := src.Bounds()
+	img := NewImage(bounds.Dy(), bounds.Dx())
+	for r := 0; r < img.Rows; r++ {
+		for c := 0; c < img.Cols; c++ {
+			gray := color.Gray16Model.Convert(src.At(bounds.Min.X+c, bounds.Min.Y+r)).(color.Gray16)
+			_, _, _, alpha := src.At(bounds.Min.X+c, bounds.Min.Y+r).RGBA()
+			// transparent pixels are treated as white paper
+			y := float64(gray.Y)/0xffff*float64(alpha)/0xffff + (1 - float64(alpha)/0xffff)
+			img.Pix[r*img.Cols+c] = mathx.Float(y)
+		}
+	}
+	return img
+}
+
+func borderMean(img *Image) float64 {
+	var sum float64
+	var n int
+	for r := 0; r < img.Rows; r++ {
+		for c := 0; c < img.Cols; c++ {
+			if r == 0 || c == 0 || r == img.Rows-1 || c == img.Cols-1 {
+				sum += float64(img.At(r, c))
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// inkThreshold is the minimum intensity of pixels belonging to the digit
+const inkThreshold = 0.1
+
+// centerImage fits the bounding box of the digit in a box of 20/28 of the
+// output size preserving aspect ratio, then moves its center of mass to
+// the center of a rows x cols image.
+func centerImage(img *Image, rows, cols int) *Image {
+	top, left, bottom, right := img.Rows, img.Cols, -1, -1
+	for r := 0; r < img.Rows; r++ {
+		for c := 0; c < img.Cols; c++ {
+			if img.At(r, c) > inkThreshold {
+				top, bottom = minInt(top, r), maxInt(bottom, r)
+				left, right = minInt(left, c), maxInt(right, c)
+			}
+		}
+	}
+	out := NewImage(rows, cols)
+	if bottom < 0 {
+		return out
+	}
+	h, w := float64(bottom-top+1), float64(right-left+1)
+	scale := math.Min(float64(rows)*20/28/h, float64(cols)*20/28/w)
+	boxRows, boxCols := int(math.Max(1, math.Round(h*scale))), int(math.Max(1, math.Round(w*scale)))
+	box := resample(img, float64(top), float64(left), h, w, boxRows, boxCols)
+
+	// center of mass of the box
+	var total, mr, mc float64
+	for r := 0; r < boxRows; r++ {
+		for c := 0; c < boxCols; c++ {
+			x := float64(box.At(r, c))
+			total += x
+			mr += x * (float64(r) + 0.5)
+			mc += x * (float64(c) + 0.5)
+		}
+	}
+	if total == 0 {
+		return out
+	}
+	offr := int(math.Round(float64(rows)/2 - mr/total))
+	offc := int(math.Round(float64(cols)/2 - mc/total))
+	for r := 0; r < boxRows; r++ {
+		for c := 0; c < boxCols; c++ {
+			if rr, cc := r+offr, c+offc; rr >= 0 && rr < rows && cc >= 0 && cc < cols {
+				out.Pix[rr*cols+cc] = box.At(r, c)
+			}
+		}
+	}
+	return out
+}
+
+// resample scales the h x w region at (top, left) of img to rows x cols by
+// averaging 4x4 bilinear samples per output pixel
+func resample(img *Image, top, left, h, w float64, rows, cols int) *Image {
+	const n = 4
+	out := NewImage(rows, cols)
+	sy, sx := h/float64(rows), w/float64(cols)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			var sum float64
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					y := top + (float64(r)+(float64(i)+0.5)/n)*sy - 0.5
+					x := left + (float64(c)+(float64(j)+0.5)/n)*sx - 0.5
+					sum += float64(img.Bilinear(y, x))
+				}
+			}
+			out.Pix[r*cols+c] = mathx.Float(sum / (n * n))
+		}
+	}
+	return out
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,125 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeSquare encodes a w x h PNG with a dark square at (x, y) on white paper
+func encodeSquare(t *testing.T, w, h, x, y, size int) []byte {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for r := y; r < y+size; r++ {
+		for c := x; c < x+size; c++ {
+			img.SetGray(c, r, color.Gray{})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func centerOfMass(img *Image) (float64, float64) {
+	var total, mr, mc float64
+	for r := 0; r < img.Rows; r++ {
+		for c := 0; c < img.Cols; c++ {
+			x := float64(img.At(r, c))
+			total += x
+			mr += x * (float64(r) + 0.5)
+			mc += x * (float64(c) + 0.5)
+		}
+	}
+	return mr / total, mc / total
+}
+
+func TestReadImageFolder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/1.png":    {Data: encodeSquare(t, 100, 60, 5, 5, 20)},
+		"a/2.png":    {Data: encodeSquare(t, 40, 40, 20, 10, 8)},
+		"a/note.txt": {Data: []byte("ignored")},
+		"b/3.png":    {Data: encodeSquare(t, 28, 28, 0, 0, 4)},
+	}
+	d, names, err := ReadImageFolder(context.Background(), fsys, FolderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+	assert.Equal(t, 3, d.Len())
+	assert.Equal(t, 2, d.NumClasses)
+	assert.Equal(t, []uint8{0, 0, 1}, d.Labels)
+	for i := 0; i < d.Len(); i++ {
+		img := d.ImageOf(i)
+		// inverted: background is black
+		assert.Equal(t, 0.0, float64(img.At(0, 0)))
+		r, c := centerOfMass(img)
+		assert.InDelta(t, 14, r, 1)
+		assert.InDelta(t, 14, c, 1)
+		// the square is scaled to fit 20x20
+		var sum float64
+		for _, x := range img.Pix {
+			sum += float64(x)
+		}
+		assert.InDelta(t, 20*20, sum, 60)
+	}
+
+	d, _, err = ReadImageFolder(context.Background(), fsys, FolderOptions{Rows: 14, Cols: 14, ClassNames: []string{"x", "b", "a"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 14*14, d.ImageSize())
+		assert.Equal(t, []uint8{2, 2, 1}, d.Labels)
+	}
+	_, _, err = ReadImageFolder(context.Background(), fsys, FolderOptions{ClassNames: []string{"a"}})
+	assert.True(t, errors.Is(err, ErrLabel), "got %v", err)
+}
+
+func TestNormalizeImageInvert(t *testing.T) {
+	data := encodeSquare(t, 28, 28, 10, 10, 8)
+	src, err := png.Decode(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// not inverted, the white paper is taken as the digit with a hole
+	img := NormalizeImage(src, FolderOptions{Invert: InvertNever})
+	assert.Equal(t, 0.0, float64(img.At(14, 14)))
+	assert.Equal(t, 1.0, float64(img.At(14, 5)))
+	img = NormalizeImage(src, FolderOptions{Invert: InvertAlways})
+	assert.Equal(t, 1.0, float64(img.At(14, 14)))
+	assert.Equal(t, 0.0, float64(img.At(14, 2)))
+
+	// empty image stays empty
+	blank := image.NewGray(image.Rect(0, 0, 10, 10))
+	assert.Equal(t, NewImage(28, 28), NormalizeImage(blank, FolderOptions{Invert: InvertNever}))
+}
+
+func TestWriteSamplesPNG(t *testing.T) {
+	d := testDataset(5)
+	samples := d.Samples()
+	filename := filepath.Join(t.TempDir(), "grid.png")
+	if !assert.NoError(t, WriteSamplesPNG(filename, samples, d.Rows, d.Cols, 3)) {
+		return
+	}
+	file, err := os.Open(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 3*(d.Cols+1)-1, 2*(d.Rows+1)-1), img.Bounds())
+		gray := img.(*image.Gray)
+		// fourth sample starts at the second grid row
+		assert.Equal(t, d.Image(3)[0], gray.GrayAt(0, d.Rows+1).Y)
+		assert.Equal(t, uint8(128), gray.GrayAt(d.Cols, 0).Y)
+	}
+}
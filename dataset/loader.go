@@ -0,0 +1,195 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Batch is a mini-batch of samples handed out by Loader
+type Batch struct {
+	// Indices of samples in the dataset
+	Indices []int
+	// Samples is set unless Loader.Stacked is true
+	Samples []*Sample
+	// Inputs and Labels are set if Loader.Stacked is true, the k-th column
+	// is the sample at Indices[k]
+	Inputs *mathx.Matrix
+	Labels *mathx.Matrix
+	// Weights are loss weights of samples if Loader.Weights is set
+	Weights []mathx.Float
+}
+
+// Size returns number of samples in the batch
+func (b *Batch) Size() int { return len(b.Indices) }
+
+// Loader iterates over a Dataset in mini-batches
+type Loader struct {
+	Dataset   *Dataset
+	BatchSize int
+	// Shuffle shuffles samples at the beginning of each epoch, ignored if
+	// Sampler is set
+	Shuffle bool
+	// Sampler decides samples of each epoch, every sample is visited once if nil
+	Sampler Sampler
+	// Weights are per-sample loss weights indexed like Dataset, handed out
+	// with batches
+	Weights []mathx.Float
+	// DropLast drops the last batch if it's smaller than BatchSize,
+	// otherwise the partial batch is kept
+	DropLast bool
+	// Stacked hands out batches as stacked matrices instead of samples
+	Stacked bool
+	// Prefetch is number of batches prepared in background ahead of the consumer
+	Prefetch int
+	// Transform is applied to each image when its batch is prepared, so every
+	// epoch sees different augmented images
+	Transform Transform
+
+	rng *rand.Rand
+}
+
+// NewLoader creates a shuffling Loader, the order of samples is determined by seed
+func NewLoader(d *Dataset, batchSize int, seed int64) *Loader {
+	return &Loader{
+		Dataset:   d,
+		BatchSize: batchSize,
+		Shuffle:   true,
+		Prefetch:  1,
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Seed resets the random source of shuffling, sampling and transforms, so that
+// following epochs only depend on seed
+func (l *Loader) Seed(seed int64) {
+	l.rng = rand.New(rand.NewSource(seed))
+}
+
+// Check returns an error if Weights or the parameters of Sampler don't match
+// Dataset, so that it's reported before batches are prepared in background
+// by Epoch. ErrShape is returned if their lengths don't match.
+func (l *Loader) Check() error {
+	if l.Weights != nil && len(l.Weights) != l.Dataset.Len() {
+		return fmt.Errorf("%w: %d loss weights for %d samples", ErrShape, len(l.Weights), l.Dataset.Len())
+	}
+	if c, ok := l.Sampler.(checker); ok {
+		return c.check(l.Dataset)
+	}
+	return nil
+}
+
+func (l *Loader) batchSize() int {
+	if l.BatchSize <= 0 {
+		return 1
+	}
+	return l.BatchSize
+}
+
+// NumBatches returns number of batches of an epoch
+func (l *Loader) NumBatches() int {
+	n := l.Dataset.Len()
+	if l.Sampler != nil {
+		n = l.Sampler.Len(l.Dataset)
+	}
+	return l.numBatches(n)
+}
+
+func (l *Loader) numBatches(n int) int {
+	size := l.batchSize()
+	if l.DropLast {
+		return n / size
+	}
+	return (n + size - 1) / size
+}
+
+func (l *Loader) random() *rand.Rand {
+	if l.rng == nil {
+		l.rng = rand.New(rand.NewSource(rand.Int63()))
+	}
+	return l.rng
+}
+
+func (l *Loader) indices() []int {
+	if l.Sampler != nil {
+		return l.Sampler.Indices(l.Dataset, l.random())
+	}
+	if l.Shuffle {
+		return l.random().Perm(l.Dataset.Len())
+	}
+	indices := make([]int, l.Dataset.Len())
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+func (l *Loader) batch(indices []int, rng *rand.Rand) *Batch {
+	b := &Batch{Indices: indices}
+	if l.Weights != nil {
+		b.Weights = make([]mathx.Float, len(indices))
+		for k, index := range indices {
+			b.Weights[k] = l.Weights[index]
+		}
+	}
+	if l.Transform != nil {
+		d := l.Dataset
+		if l.Stacked {
+			b.Inputs = mathx.NewMatrix(d.ImageSize(), len(indices))
+			b.Labels = mathx.NewMatrix(d.NumClasses, len(indices))
+		} else {
+			b.Samples = make([]*Sample, len(indices))
+		}
+		for k, index := range indices {
+			img := l.Transform.Apply(d.ImageOf(index), rng)
+			if l.Stacked {
+				for j, x := range img.Pix {
+					b.Inputs.Set(j, k, x)
+				}
+				b.Labels.Set(d.Label(index), k, 1)
+			} else {
+				b.Samples[k] = &Sample{Input: img.Vector(), Label: toLabel(d.Label(index), d.NumClasses)}
+			}
+		}
+		return b
+	}
+	if l.Stacked {
+		b.Inputs, b.Labels = l.Dataset.Batch(indices)
+	} else {
+		b.Samples = l.Dataset.SamplesAt(indices)
+	}
+	return b
+}
+
+// Epoch starts an epoch and returns a channel of batches which is closed
+// after the last batch. Batches are prepared by a background goroutine,
+// cancel ctx to stop the epoch early.
+func (l *Loader) Epoch(ctx context.Context) <-chan *Batch {
+	indices := l.indices()
+	// transforms draw from their own source so that the background goroutine
+	// never shares l.rng with the next epoch
+	rng := rand.New(rand.NewSource(l.random().Int63()))
+	size, num := l.batchSize(), l.numBatches(len(indices))
+	prefetch := l.Prefetch
+	if prefetch < 0 {
+		prefetch = 0
+	}
+	ch := make(chan *Batch, prefetch)
+	go func() {
+		defer close(ch)
+		for i := 0; i < num && ctx.Err() == nil; i++ {
+			end := (i + 1) * size
+			if end > len(indices) {
+				end = len(indices)
+			}
+			select {
+			case ch <- l.batch(indices[i*size:end], rng):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
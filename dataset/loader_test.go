@@ -0,0 +1,69 @@
+package dataset
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDataset(n int) *Dataset {
+	d := &Dataset{Rows: 1, Cols: 2, NumClasses: 10, Images: make([]uint8, n*2), Labels: make([]uint8, n)}
+	for i := 0; i < n; i++ {
+		d.Images[i*2] = uint8(i)
+		d.Labels[i] = uint8(i % 10)
+	}
+	return d
+}
+
+func collect(l *Loader) (sizes, indices []int) {
+	for b := range l.Epoch(context.Background()) {
+		sizes = append(sizes, b.Size())
+		indices = append(indices, b.Indices...)
+	}
+	return
+}
+
+func TestLoader(t *testing.T) {
+	d := testDataset(10)
+	l := NewLoader(d, 4, 1)
+	assert.Equal(t, 3, l.NumBatches())
+	sizes, indices := collect(l)
+	assert.Equal(t, []int{4, 4, 2}, sizes)
+	sort.Ints(indices)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, indices)
+
+	l.DropLast = true
+	assert.Equal(t, 2, l.NumBatches())
+	sizes, _ = collect(l)
+	assert.Equal(t, []int{4, 4}, sizes)
+
+	// same seed, same order
+	_, a := collect(NewLoader(d, 3, 7))
+	_, b := collect(NewLoader(d, 3, 7))
+	assert.Equal(t, a, b)
+
+	l = NewLoader(d, 5, 1)
+	l.Shuffle = false
+	l.Stacked = true
+	for b := range l.Epoch(context.Background()) {
+		assert.Nil(t, b.Samples)
+		assert.Equal(t, 5, b.Inputs.ColCount())
+		assert.Equal(t, 10, b.Labels.RowCount())
+		for k, i := range b.Indices {
+			assert.True(t, d.Input(i).Equal(b.Inputs.Col(k)))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l = NewLoader(d, 1, 1)
+	ch := l.Epoch(ctx)
+	<-ch
+	cancel()
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Less(t, n, 9)
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package dataset
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads size bytes of file into memory on platforms without mmap
+func mapFile(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error { return nil }
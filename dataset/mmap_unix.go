@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package dataset
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of file into memory as a private copy-on-write mapping
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,139 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LabelNoise flips labels of a fraction of samples to study robustness to
+// mislabeled data
+type LabelNoise struct {
+	// Rate is the fraction of samples whose label is flipped
+	Rate float64
+	// Confusion[i][j] is the relative probability that a flipped label of
+	// class i becomes j, the diagonal is ignored. Labels are flipped
+	// uniformly to other classes if nil.
+	Confusion [][]float64
+}
+
+// PairConfusion returns a confusion matrix which flips class i to class i+1
+func PairConfusion(numClasses int) [][]float64 {
+	confusion := make([][]float64, numClasses)
+	for i := range confusion {
+		confusion[i] = make([]float64, numClasses)
+		confusion[i][(i+1)%numClasses] = 1
+	}
+	return confusion
+}
+
+// Apply returns a copy of d with corrupted labels and sorted indices of samples
+// whose label was changed. Samples of a class whose confusion row has no weight
+// off the diagonal are never changed.
+func (n *LabelNoise) Apply(d *Dataset, rng *rand.Rand) (*Dataset, []int) {
+	noisy := &Dataset{
+		Rows:       d.Rows,
+		Cols:       d.Cols,
+		NumClasses: d.NumClasses,
+		Images:     d.Images,
+		Labels:     append([]uint8(nil), d.Labels...),
+	}
+	num := int(n.Rate*float64(d.Len()) + 0.5)
+	if num > d.Len() {
+		num = d.Len()
+	}
+	var flipped []int
+	for _, i := range rng.Perm(d.Len())[:num] {
+		label := d.Label(i)
+		if target := n.flip(label, d.NumClasses, rng); target != label {
+			noisy.Labels[i] = uint8(target)
+			flipped = append(flipped, i)
+		}
+	}
+	sort.Ints(flipped)
+	return noisy, flipped
+}
+
+func (n *LabelNoise) flip(label, numClasses int, rng *rand.Rand) int {
+	if n.Confusion == nil {
+		if numClasses < 2 {
+			return label
+		}
+		target := rng.Intn(numClasses - 1)
+		if target >= label {
+			target++
+		}
+		return target
+	}
+	row := n.Confusion[label]
+	var total float64
+	for j, w := range row {
+		if j != label && w > 0 {
+			total += w
+		}
+	}
+	if total == 0 {
+		return label
+	}
+	x := rng.Float64() * total
+	for j, w := range row {
+		if j == label || w <= 0 {
+			continue
+		}
+		if x -= w; x < 0 {
+			return j
+		}
+	}
+	// rounding error, take the last candidate
+	for j := len(row) - 1; j >= 0; j-- {
+		if j != label && row[j] > 0 {
+			return j
+		}
+	}
+	return label
+}
+
+// ParseLabelNoise parses a label noise spec: uniform=rate, pair=rate or
+// confusion=rate:file where file is a JSON confusion matrix, nil returned if
+// spec is empty
+func ParseLabelNoise(spec string, numClasses int) (*LabelNoise, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	name, arg, _ := strings.Cut(spec, "=")
+	arg, file, _ := strings.Cut(arg, ":")
+	rate, err := strconv.ParseFloat(arg, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("invalid label noise rate %q", arg)
+	}
+	n := &LabelNoise{Rate: rate}
+	switch name {
+	case "uniform":
+	case "pair":
+		n.Confusion = PairConfusion(numClasses)
+	case "confusion":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &n.Confusion); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(n.Confusion) != numClasses {
+			return nil, fmt.Errorf("%s: %w: %d rows for %d classes", file, ErrShape, len(n.Confusion), numClasses)
+		}
+		for i, row := range n.Confusion {
+			if len(row) != numClasses {
+				return nil, fmt.Errorf("%s: %w: row %d has %d columns for %d classes", file, ErrShape, i, len(row), numClasses)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown label noise %q", spec)
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package dataset
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelNoise(t *testing.T) {
+	d := &Dataset{Rows: 1, Cols: 1, NumClasses: 4, Images: make([]uint8, 1000), Labels: make([]uint8, 1000)}
+	for i := range d.Labels {
+		d.Labels[i] = uint8(i % 4)
+	}
+	original := append([]uint8(nil), d.Labels...)
+
+	noisy, flipped := (&LabelNoise{Rate: 0.2}).Apply(d, rand.New(rand.NewSource(1)))
+	assert.Equal(t, original, d.Labels, "source labels unchanged")
+	assert.Equal(t, 200, len(flipped))
+	assert.IsIncreasing(t, flipped)
+	changed := 0
+	for i := range d.Labels {
+		if noisy.Labels[i] != d.Labels[i] {
+			changed++
+		}
+	}
+	assert.Equal(t, 200, changed)
+	for _, i := range flipped {
+		assert.NotEqual(t, d.Label(i), noisy.Label(i))
+	}
+
+	noisy, flipped = (&LabelNoise{Rate: 0.5, Confusion: PairConfusion(4)}).Apply(d, rand.New(rand.NewSource(1)))
+	assert.Equal(t, 500, len(flipped))
+	for _, i := range flipped {
+		assert.Equal(t, (d.Label(i)+1)%4, noisy.Label(i))
+	}
+
+	// class 0 is never flipped, class 1 only to class 2
+	confusion := [][]float64{{1, 0, 0, 0}, {0, 0, 1, 0}, {1, 1, 0, 1}, {1, 1, 1, 1}}
+	noisy, flipped = (&LabelNoise{Rate: 1, Confusion: confusion}).Apply(d, rand.New(rand.NewSource(1)))
+	assert.Equal(t, 750, len(flipped))
+	for _, i := range flipped {
+		assert.NotEqual(t, 0, d.Label(i))
+		if d.Label(i) == 1 {
+			assert.Equal(t, 2, noisy.Label(i))
+		}
+	}
+}
+
+func TestParseLabelNoise(t *testing.T) {
+	n, err := ParseLabelNoise("", 10)
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+
+	n, err = ParseLabelNoise("uniform=0.4", 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &LabelNoise{Rate: 0.4}, n)
+	}
+	n, err = ParseLabelNoise("pair=0.1", 3)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &LabelNoise{Rate: 0.1, Confusion: PairConfusion(3)}, n)
+	}
+
+	file := filepath.Join(t.TempDir(), "confusion.json")
+	assert.NoError(t, os.WriteFile(file, []byte("[[0,1],[1,0]]"), 0644))
+	n, err = ParseLabelNoise("confusion=0.3:"+file, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &LabelNoise{Rate: 0.3, Confusion: [][]float64{{0, 1}, {1, 0}}}, n)
+	}
+	_, err = ParseLabelNoise("confusion=0.3:"+file, 3)
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+
+	for _, spec := range []string{"uniform", "uniform=2", "pair=-0.1", "flip=0.1", "confusion=0.1:missing.json"} {
+		_, err := ParseLabelNoise(spec, 10)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,348 @@
+package dataset
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Inputs are the training inputs a Preprocessor is fitted on
+type Inputs struct {
+	Rows, Cols int
+	Len        int
+	// At returns the i-th input as a column vector, it must not be modified
+	At func(i int) *mathx.Matrix
+}
+
+// Preprocessor is a preprocessing step which is fitted on training inputs and
+// then applied to every input: training, validation, test and inference.
+// Fitted parameters are exported so that they can be serialized by gob.
+type Preprocessor interface {
+	Fit(inputs Inputs)
+	// Apply returns the preprocessed input, input is not modified
+	Apply(input *mathx.Matrix) *mathx.Matrix
+}
+
+func init() {
+	gob.Register(&PixelStandardize{})
+	gob.Register(&GlobalStandardize{})
+	gob.Register(&ZCA{})
+	gob.Register(&Deskew{})
+	gob.Register(&Binarize{})
+}
+
+// Pipeline applies preprocessors in order, each step is fitted on outputs of previous steps
+type Pipeline struct {
+	Steps []Preprocessor
+}
+
+// Fit fits all steps on inputs of d
+func (p *Pipeline) Fit(d *Dataset) {
+	for k, step := range p.Steps {
+		prev := p.Steps[:k]
+		step.Fit(Inputs{
+			Rows: d.Rows,
+			Cols: d.Cols,
+			Len:  d.Len(),
+			At: func(i int) *mathx.Matrix {
+				input := d.Input(i)
+				for _, s := range prev {
+					input = s.Apply(input)
+				}
+				return input
+			},
+		})
+	}
+}
+
+func (p *Pipeline) Apply(input *mathx.Matrix) *mathx.Matrix {
+	for _, step := range p.Steps {
+		input = step.Apply(input)
+	}
+	return input
+}
+
+// ParsePipeline parses comma separated preprocessing steps:
+//
+//	deskew                deskew by image moments
+//	binarize[=threshold]  binarize with threshold, default 0.5
+//	standardize           per-pixel mean/std standardization
+//	global-standardize    global mean/std standardization
+//	zca[=epsilon]         ZCA whitening with regularization epsilon, default 0.1
+func ParsePipeline(spec string) (*Pipeline, error) {
+	p := new(Pipeline)
+	for _, item := range strings.Split(spec, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(item), "=")
+		var value mathx.Float
+		if hasArg {
+			x, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("preprocess %s: %w", name, err)
+			}
+			value = mathx.Float(x)
+		}
+		switch name {
+		case "":
+			continue
+		case "deskew":
+			p.Steps = append(p.Steps, &Deskew{})
+		case "binarize":
+			if !hasArg {
+				value = 0.5
+			}
+			p.Steps = append(p.Steps, &Binarize{Threshold: value})
+		case "standardize":
+			p.Steps = append(p.Steps, &PixelStandardize{})
+		case "global-standardize":
+			p.Steps = append(p.Steps, &GlobalStandardize{})
+		case "zca":
+			if !hasArg {
+				value = 0.1
+			}
+			p.Steps = append(p.Steps, &ZCA{Epsilon: value})
+		default:
+			return nil, fmt.Errorf("unknown preprocessing step %q", name)
+		}
+	}
+	if len(p.Steps) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// stdEpsilon avoids division by zero for constant pixels
+const stdEpsilon = 1e-8
+
+// PixelStandardize standardizes each pixel by its mean and standard deviation
+type PixelStandardize struct {
+	Mean []mathx.Float
+	Std  []mathx.Float
+}
+
+func (s *PixelStandardize) Fit(inputs Inputs) {
+	size := inputs.Rows * inputs.Cols
+	sum, sqsum := make([]float64, size), make([]float64, size)
+	for i := 0; i < inputs.Len; i++ {
+		for j, x := range inputs.At(i).Slice() {
+			sum[j] += float64(x)
+			sqsum[j] += float64(x * x)
+		}
+	}
+	s.Mean, s.Std = make([]mathx.Float, size), make([]mathx.Float, size)
+	if inputs.Len == 0 {
+		return
+	}
+	n := float64(inputs.Len)
+	for j := range sum {
+		mean := sum[j] / n
+		s.Mean[j] = mathx.Float(mean)
+		s.Std[j] = mathx.Float(math.Sqrt(math.Max(sqsum[j]/n-mean*mean, 0)))
+	}
+}
+
+func (s *PixelStandardize) Apply(input *mathx.Matrix) *mathx.Matrix {
+	out := mathx.NewMatrix(input.RowCount(), 1)
+	for j := range s.Mean {
+		out.Set(j, 0, (input.Get(j, 0)-s.Mean[j])/(s.Std[j]+stdEpsilon))
+	}
+	return out
+}
+
+// GlobalStandardize standardizes all pixels by the mean and standard deviation of all pixels
+type GlobalStandardize struct {
+	Mean mathx.Float
+	Std  mathx.Float
+}
+
+func (s *GlobalStandardize) Fit(inputs Inputs) {
+	var sum, sqsum float64
+	var n int
+	for i := 0; i < inputs.Len; i++ {
+		for _, x := range inputs.At(i).Slice() {
+			sum += float64(x)
+			sqsum += float64(x * x)
+			n++
+		}
+	}
+	if n == 0 {
+		s.Mean, s.Std = 0, 1
+		return
+	}
+	mean := sum / float64(n)
+	s.Mean = mathx.Float(mean)
+	s.Std = mathx.Float(math.Sqrt(math.Max(sqsum/float64(n)-mean*mean, 0)))
+}
+
+func (s *GlobalStandardize) Apply(input *mathx.Matrix) *mathx.Matrix {
+	mean, std := s.Mean, s.Std+stdEpsilon
+	return input.Map(func(x mathx.Float) mathx.Float { return (x - mean) / std })
+}
+
+// zcaMaxSamples limits number of samples used to estimate the covariance matrix
+const zcaMaxSamples = 10000
+
+// ZCA whitens inputs: W = U * diag(1/sqrt(lambda+Epsilon)) * U^T where
+// U and lambda are eigenvectors and eigenvalues of the covariance matrix.
+// Applying it costs O(n^2) per input of n pixels.
+type ZCA struct {
+	Epsilon mathx.Float
+	Mean    []mathx.Float
+	W       *mathx.Matrix
+}
+
+func (z *ZCA) Fit(inputs Inputs) {
+	size := inputs.Rows * inputs.Cols
+	step := 1
+	if inputs.Len > zcaMaxSamples {
+		step = (inputs.Len + zcaMaxSamples - 1) / zcaMaxSamples
+	}
+	var samples [][]mathx.Float
+	mean := make([]float64, size)
+	for i := 0; i < inputs.Len; i += step {
+		x := inputs.At(i).Slice()
+		samples = append(samples, x)
+		for j := range mean {
+			mean[j] += float64(x[j])
+		}
+	}
+	z.Mean = make([]mathx.Float, size)
+	if len(samples) == 0 {
+		z.W = mathx.NewUnitSquareMatrix(size)
+		return
+	}
+	for j := range mean {
+		mean[j] /= float64(len(samples))
+		z.Mean[j] = mathx.Float(mean[j])
+	}
+	cov := mathx.NewSquareMatrix(size)
+	c := cov.Slice()
+	centered := make([]float64, size)
+	for _, x := range samples {
+		for j := range centered {
+			centered[j] = float64(x[j]) - mean[j]
+		}
+		for j := 0; j < size; j++ {
+			if centered[j] == 0 {
+				continue
+			}
+			row := c[j*size : (j+1)*size]
+			for k := j; k < size; k++ {
+				row[k] += mathx.Float(centered[j] * centered[k])
+			}
+		}
+	}
+	n := mathx.Float(len(samples))
+	for j := 0; j < size; j++ {
+		for k := j; k < size; k++ {
+			c[j*size+k] /= n
+			c[k*size+j] = c[j*size+k]
+		}
+	}
+
+	values, vectors := mathx.SymmetricEigen(cov)
+	u := vectors.Slice()
+	z.W = mathx.NewSquareMatrix(size)
+	w := z.W.Slice()
+	scales := make([]mathx.Float, size)
+	for k, value := range values {
+		if value < 0 {
+			value = 0
+		}
+		scales[k] = mathx.Float(1 / math.Sqrt(float64(value+z.Epsilon)))
+	}
+	for i := 0; i < size; i++ {
+		for j := i; j < size; j++ {
+			var sum mathx.Float
+			for k := 0; k < size; k++ {
+				sum += u[i*size+k] * scales[k] * u[j*size+k]
+			}
+			w[i*size+j], w[j*size+i] = sum, sum
+		}
+	}
+}
+
+func (z *ZCA) Apply(input *mathx.Matrix) *mathx.Matrix {
+	size := len(z.Mean)
+	centered := make([]mathx.Float, size)
+	for j := range centered {
+		centered[j] = input.Get(j, 0) - z.Mean[j]
+	}
+	out := make([]mathx.Float, size)
+	w := z.W.Slice()
+	for i := range out {
+		var sum mathx.Float
+		for j, x := range w[i*size : (i+1)*size] {
+			sum += x * centered[j]
+		}
+		out[i] = sum
+	}
+	return mathx.NewMatrixWithColVector(out)
+}
+
+// Deskew removes the skew of an image estimated by its second order moments
+// and moves its center of mass to the image center.
+type Deskew struct {
+	Rows, Cols int
+}
+
+func (s *Deskew) Fit(inputs Inputs) {
+	s.Rows, s.Cols = inputs.Rows, inputs.Cols
+}
+
+func (s *Deskew) Apply(input *mathx.Matrix) *mathx.Matrix {
+	img := &Image{Rows: s.Rows, Cols: s.Cols, Pix: input.Slice()}
+	var total, mr, mc float64
+	for r := 0; r < s.Rows; r++ {
+		for c := 0; c < s.Cols; c++ {
+			x := float64(img.At(r, c))
+			total += x
+			mr += x * float64(r)
+			mc += x * float64(c)
+		}
+	}
+	if total == 0 {
+		return input.Clone()
+	}
+	mr, mc = mr/total, mc/total
+	var varr, covrc float64
+	for r := 0; r < s.Rows; r++ {
+		for c := 0; c < s.Cols; c++ {
+			x := float64(img.At(r, c))
+			varr += x * (float64(r) - mr) * (float64(r) - mr)
+			covrc += x * (float64(r) - mr) * (float64(c) - mc)
+		}
+	}
+	var alpha float64
+	if varr > 0 {
+		alpha = covrc / varr
+	}
+	out := NewImage(s.Rows, s.Cols)
+	or, oc := float64(s.Rows-1)/2, float64(s.Cols-1)/2
+	for r := 0; r < s.Rows; r++ {
+		for c := 0; c < s.Cols; c++ {
+			dr := float64(r) - or
+			out.Pix[r*s.Cols+c] = img.Bilinear(mr+dr, mc+alpha*dr+float64(c)-oc)
+		}
+	}
+	return out.Vector()
+}
+
+// Binarize maps pixels greater than or equal to Threshold to 1 and others to 0
+type Binarize struct {
+	Threshold mathx.Float
+}
+
+func (b *Binarize) Fit(inputs Inputs) {}
+
+func (b *Binarize) Apply(input *mathx.Matrix) *mathx.Matrix {
+	return input.Map(func(x mathx.Float) mathx.Float {
+		if x >= b.Threshold {
+			return 1
+		}
+		return 0
+	})
+}
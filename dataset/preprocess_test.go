@@ -0,0 +1,86 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/rand"
+	"testing"
+
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func randomDataset(n, rows, cols int, seed int64) *Dataset {
+	rng := rand.New(rand.NewSource(seed))
+	d := &Dataset{Rows: rows, Cols: cols, NumClasses: 10, Images: make([]uint8, n*rows*cols), Labels: make([]uint8, n)}
+	for i := range d.Images {
+		// correlated pixels
+		d.Images[i] = uint8(rng.Intn(128) + int(d.Images[i/2]/2))
+	}
+	return d
+}
+
+func TestPipeline(t *testing.T) {
+	d := randomDataset(500, 2, 3, 1)
+	p, err := ParsePipeline("standardize")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p.Fit(d)
+	sum := make([]float64, 6)
+	for i := 0; i < d.Len(); i++ {
+		for j, x := range p.Apply(d.Input(i)).Slice() {
+			sum[j] += float64(x)
+		}
+	}
+	for _, x := range sum {
+		assert.InDelta(t, 0, x/float64(d.Len()), 1e-6)
+	}
+
+	// whitened inputs have identity covariance
+	p = &Pipeline{Steps: []Preprocessor{&ZCA{Epsilon: 1e-9}}}
+	p.Fit(d)
+	cov := mathx.NewSquareMatrix(6)
+	for i := 0; i < d.Len(); i++ {
+		x := p.Apply(d.Input(i))
+		cov.AddWith(x.Mul(x.T()))
+	}
+	cov.ScaleWith(1 / mathx.Float(d.Len()))
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 6; j++ {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			assert.InDelta(t, want, float64(cov.Get(i, j)), 1e-4)
+		}
+	}
+
+	// fitted parameters survive serialization
+	p, err = ParsePipeline("deskew, binarize=0.2, global-standardize, zca=0.01")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p.Fit(d)
+	var buf bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&buf).Encode(p))
+	p2 := new(Pipeline)
+	assert.NoError(t, gob.NewDecoder(&buf).Decode(p2))
+	assert.True(t, p.Apply(d.Input(3)).Equal(p2.Apply(d.Input(3))))
+
+	_, err = ParsePipeline("whiten")
+	assert.Error(t, err)
+}
+
+func TestDeskew(t *testing.T) {
+	// a diagonal stroke becomes vertical
+	img := NewImage(9, 9)
+	for r := 1; r < 8; r++ {
+		img.Pix[r*9+r] = 1
+	}
+	s := &Deskew{Rows: 9, Cols: 9}
+	out := s.Apply(img.Vector())
+	for r := 1; r < 8; r++ {
+		assert.InDelta(t, 1, float64(out.Get(r*9+4, 0)), 1e-6, "row %d", r)
+	}
+}
@@ -0,0 +1,208 @@
+package dataset
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Info describes a dataset stored in IDX files
+type Info struct {
+	Name string
+	// URL is the default remote root URL, empty if the dataset can't be
+	// downloaded file by file
+	URL string
+
+	TrainingImages string
+	TrainingLabels string
+	TestImages     string
+	TestLabels     string
+
+	NumClasses int
+	ClassNames []string
+	// LabelOffset is the value of the first label, e.g. EMNIST letters are labeled from 1
+	LabelOffset int
+	// Transposed reports whether images are stored column by column
+	Transposed bool
+	// Checksums holds hex encoded SHA-256 of known files indexed by file name,
+	// downloaded files are verified against it
+	Checksums map[string]string
+}
+
+// LoadTrainingSet reads training set from root which is a local directory or a remote root URL
+func (info *Info) LoadTrainingSet(ctx context.Context, root string) (*Dataset, error) {
+	return info.format().readFiles(ctx, joinFilename(root, info.TrainingImages), joinFilename(root, info.TrainingLabels))
+}
+
+// LoadTestSet reads test set from root which is a local directory or a remote root URL
+func (info *Info) LoadTestSet(ctx context.Context, root string) (*Dataset, error) {
+	return info.format().readFiles(ctx, joinFilename(root, info.TestImages), joinFilename(root, info.TestLabels))
+}
+
+// ReadTrainingSet is like LoadTrainingSet but returns samples
+func (info *Info) ReadTrainingSet(ctx context.Context, root string) ([]*Sample, error) {
+	d, err := info.LoadTrainingSet(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	return d.Samples(), nil
+}
+
+// ReadTestSet is like LoadTestSet but returns samples
+func (info *Info) ReadTestSet(ctx context.Context, root string) ([]*Sample, error) {
+	d, err := info.LoadTestSet(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	return d.Samples(), nil
+}
+
+// ReadImages reads images from r which may be gzip compressed
+func (info *Info) ReadImages(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	return info.format().readImages(ctx, r)
+}
+
+// ReadLabels reads labels from r which may be gzip compressed
+func (info *Info) ReadLabels(ctx context.Context, r io.Reader) ([]*mathx.Matrix, error) {
+	return info.format().readLabels(ctx, r)
+}
+
+// LoadFS reads training set and test set from fsys
+func (info *Info) LoadFS(ctx context.Context, fsys fs.FS) (trainingdata, testdata *Dataset, err error) {
+	f := info.format()
+	if trainingdata, err = f.loadFS(ctx, fsys, info.TrainingImages, info.TrainingLabels); err != nil {
+		return nil, nil, err
+	}
+	if testdata, err = f.loadFS(ctx, fsys, info.TestImages, info.TestLabels); err != nil {
+		return nil, nil, err
+	}
+	return trainingdata, testdata, nil
+}
+
+func (info *Info) format() format {
+	return format{
+		numClasses:  info.NumClasses,
+		labelOffset: info.LabelOffset,
+		transposed:  info.Transposed,
+		checksums:   info.Checksums,
+	}
+}
+
+var registry = map[string]*Info{}
+
+// Register registers a dataset, it panics if the name is already registered
+func Register(info *Info) {
+	if _, dup := registry[info.Name]; dup {
+		panic(fmt.Sprintf("dataset %q registered twice", info.Name))
+	}
+	registry[info.Name] = info
+}
+
+// Lookup returns the registered dataset by name
+func Lookup(name string) (*Info, bool) {
+	info, ok := registry[name]
+	return info, ok
+}
+
+// Names returns sorted names of all registered datasets
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func chars(first, last byte) []string {
+	names := make([]string, 0, last-first+1)
+	for c := first; c <= last; c++ {
+		names = append(names, string(c))
+	}
+	return names
+}
+
+func concat(lists ...[]string) []string {
+	var names []string
+	for _, list := range lists {
+		names = append(names, list...)
+	}
+	return names
+}
+
+func idxInfo(name, url, prefix string, classNames []string) *Info {
+	return &Info{
+		Name:           name,
+		URL:            url,
+		TrainingImages: prefix + "train-images-idx3-ubyte.gz",
+		TrainingLabels: prefix + "train-labels-idx1-ubyte.gz",
+		TestImages:     prefix + "t10k-images-idx3-ubyte.gz",
+		TestLabels:     prefix + "t10k-labels-idx1-ubyte.gz",
+		NumClasses:     len(classNames),
+		ClassNames:     classNames,
+	}
+}
+
+// emnistInfo describes an EMNIST split. EMNIST is distributed as a single
+// archive, so there is no URL and the files must be extracted to a local directory.
+func emnistInfo(split string, classNames []string, labelOffset int) *Info {
+	prefix := "emnist-" + split + "-"
+	return &Info{
+		Name:           "emnist-" + split,
+		TrainingImages: prefix + "train-images-idx3-ubyte.gz",
+		TrainingLabels: prefix + "train-labels-idx1-ubyte.gz",
+		TestImages:     prefix + "test-images-idx3-ubyte.gz",
+		TestLabels:     prefix + "test-labels-idx1-ubyte.gz",
+		NumClasses:     len(classNames),
+		ClassNames:     classNames,
+		LabelOffset:    labelOffset,
+		Transposed:     true,
+	}
+}
+
+var (
+	MNIST = idxInfo("mnist", "http://yann.lecun.com/exdb/mnist", "", chars('0', '9'))
+
+	FashionMNIST = idxInfo("fashion-mnist", "http://fashion-mnist.s3-website.eu-central-1.amazonaws.com", "", []string{
+		"T-shirt/top", "Trouser", "Pullover", "Dress", "Coat",
+		"Sandal", "Shirt", "Sneaker", "Bag", "Ankle boot",
+	})
+
+	KMNIST = idxInfo("kmnist", "http://codh.rois.ac.jp/kmnist/dataset/kmnist", "", []string{
+		"o", "ki", "su", "tsu", "na", "ha", "ma", "ya", "re", "wo",
+	})
+
+	EMNISTBalanced = emnistInfo("balanced", concat(chars('0', '9'), chars('A', 'Z'), strings.Split("a b d e f g h n q r t", " ")), 0)
+	EMNISTLetters  = emnistInfo("letters", chars('A', 'Z'), 1)
+	EMNISTByClass  = emnistInfo("byclass", concat(chars('0', '9'), chars('A', 'Z'), chars('a', 'z')), 0)
+)
+
+func init() {
+	MNIST.Checksums = map[string]string{
+		MNIST.TrainingImages: "440fcabf73cc546fa21475e81ea370265605f56be210a4024d2ca8f203523609",
+		MNIST.TrainingLabels: "3552534a0a558bbed6aed32b30c495cca23d567ec52cac8be1a0730e8010255c",
+		MNIST.TestImages:     "8d422c7b0a1c1c79245a5bcf07fe86e33eeafee792b84584aec276f5a2dbc4e6",
+		MNIST.TestLabels:     "f7ae60f92e00ec6debd23a6088c31dbd2371eca3ffa0defaefb259924204aec6",
+	}
+	FashionMNIST.Checksums = map[string]string{
+		FashionMNIST.TrainingImages: "3aede38d61863908ad78613f6a32ed271626dd12800ba2636569512369268a84",
+		FashionMNIST.TrainingLabels: "a04f17134ac03560a47e3764e11b92fc97de4d1bfaf8ba1a3aa29af54cc90845",
+		FashionMNIST.TestImages:     "346e55b948d973a97e58d2351dde16a484bd415d4595297633bb08f03db6a073",
+		FashionMNIST.TestLabels:     "67da17c76eaffca5446c3361aaab5c3cd6d1c2608764d35dfb1850b086bf8dd5",
+	}
+	KMNIST.Checksums = map[string]string{
+		KMNIST.TrainingImages: "51467d22d8cc72929e2a028a0428f2086b092bb31cfb79c69cc0a90ce135fde4",
+		KMNIST.TrainingLabels: "e38f9ebcd0f3ebcdec7fc8eabdcdaef93bb0df8ea12bee65224341c8183d8e17",
+		KMNIST.TestImages:     "edd7a857845ad6bb1d0ba43fe7e794d164fe2dce499a1694695a792adfac43c5",
+		KMNIST.TestLabels:     "20bb9a0ef54c7db3efc55a92eef5582c109615df22683c380526788f98e42a1c",
+	}
+
+	for _, info := range []*Info{MNIST, FashionMNIST, KMNIST, EMNISTBalanced, EMNISTLetters, EMNISTByClass} {
+		Register(info)
+	}
+}
@@ -0,0 +1,298 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Sampler decides which samples a Loader visits in an epoch and in which order
+type Sampler interface {
+	// Len returns number of samples of an epoch
+	Len(d *Dataset) int
+	// Indices returns indices of samples of an epoch, an index may repeat
+	Indices(d *Dataset, rng *rand.Rand) []int
+}
+
+// checker is implemented by samplers whose parameters must match the
+// dataset, see Loader.Check
+type checker interface {
+	check(d *Dataset) error
+}
+
+// WeightedSampler draws d.Len() samples with replacement, the probability of
+// a sample is proportional to its weight
+type WeightedSampler struct {
+	Weights []mathx.Float
+}
+
+func (s *WeightedSampler) Len(d *Dataset) int { return d.Len() }
+
+func (s *WeightedSampler) Indices(d *Dataset, rng *rand.Rand) []int {
+	return drawWeighted(s.Weights, d.Len(), rng)
+}
+
+func (s *WeightedSampler) check(d *Dataset) error {
+	if len(s.Weights) != d.Len() {
+		return fmt.Errorf("%w: %d sampling weights for %d samples", ErrShape, len(s.Weights), d.Len())
+	}
+	if d.Len() > 0 && !anyPositive(s.Weights) {
+		return errors.New("no sample has a positive sampling weight")
+	}
+	return nil
+}
+
+func anyPositive(weights []mathx.Float) bool {
+	for _, w := range weights {
+		if w > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// drawWeighted draws n indices of weights with replacement, nil is returned
+// if no weight is positive, which is reported by Loader.Check
+func drawWeighted(weights []mathx.Float, n int, rng *rand.Rand) []int {
+	cumulative := make([]float64, len(weights))
+	var total float64
+	for i, w := range weights {
+		if w > 0 {
+			total += float64(w)
+		}
+		cumulative[i] = total
+	}
+	if total == 0 {
+		return nil
+	}
+	indices := make([]int, n)
+	for i := range indices {
+		x := rng.Float64() * total
+		indices[i] = sort.Search(len(cumulative), func(j int) bool { return cumulative[j] > x })
+	}
+	return indices
+}
+
+// ClassSampler draws d.Len() samples with replacement, a class is drawn with
+// probability proportional to its weight, then a sample of the class is drawn
+// uniformly. Classes are equally likely if ClassWeights is nil.
+type ClassSampler struct {
+	ClassWeights []mathx.Float
+}
+
+func (s *ClassSampler) Len(d *Dataset) int { return d.Len() }
+
+func (s *ClassSampler) Indices(d *Dataset, rng *rand.Rand) []int {
+	classes := d.classIndices()
+	weights := make([]mathx.Float, d.Len())
+	for label, indices := range classes {
+		if len(indices) == 0 {
+			continue
+		}
+		w := mathx.Float(1)
+		if s.ClassWeights != nil {
+			w = s.ClassWeights[label]
+		}
+		for _, i := range indices {
+			weights[i] = w / mathx.Float(len(indices))
+		}
+	}
+	return drawWeighted(weights, d.Len(), rng)
+}
+
+func (s *ClassSampler) check(d *Dataset) error {
+	if s.ClassWeights == nil {
+		return nil
+	}
+	if len(s.ClassWeights) != d.NumClasses {
+		return fmt.Errorf("%w: %d sampling weights for %d classes", ErrShape, len(s.ClassWeights), d.NumClasses)
+	}
+	for label, indices := range d.classIndices() {
+		if len(indices) > 0 && s.ClassWeights[label] > 0 {
+			return nil
+		}
+	}
+	if d.Len() > 0 {
+		return errors.New("no class of the dataset has a positive sampling weight")
+	}
+	return nil
+}
+
+// Oversampler balances classes by repeating samples of each class at random
+// until it's as large as the largest class, every sample is visited at
+// least once per epoch
+type Oversampler struct{}
+
+func (Oversampler) Len(d *Dataset) int {
+	max, nonempty := 0, 0
+	for _, indices := range d.classIndices() {
+		if len(indices) > max {
+			max = len(indices)
+		}
+		if len(indices) > 0 {
+			nonempty++
+		}
+	}
+	return max * nonempty
+}
+
+func (s Oversampler) Indices(d *Dataset, rng *rand.Rand) []int {
+	classes := d.classIndices()
+	result := make([]int, 0, s.Len(d))
+	max := 0
+	for _, indices := range classes {
+		if len(indices) > max {
+			max = len(indices)
+		}
+	}
+	for _, indices := range classes {
+		if len(indices) == 0 {
+			continue
+		}
+		result = append(result, indices...)
+		for k := len(indices); k < max; k++ {
+			result = append(result, indices[rng.Intn(len(indices))])
+		}
+	}
+	rng.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
+
+// ParseSampler parses a sampler spec: uniform (nil Sampler), balanced,
+// oversample or class=w0,w1,... for per-class weights
+func ParseSampler(spec string) (Sampler, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(spec), "=")
+	switch name {
+	case "", "uniform":
+		return nil, nil
+	case "balanced":
+		return &ClassSampler{}, nil
+	case "oversample":
+		return Oversampler{}, nil
+	case "class":
+		weights, err := parseWeights(arg)
+		if err != nil {
+			return nil, err
+		}
+		if allZero(weights) {
+			return nil, fmt.Errorf("sampler %q: all class weights are 0", spec)
+		}
+		return &ClassSampler{ClassWeights: weights}, nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", spec)
+}
+
+func parseWeights(s string) ([]mathx.Float, error) {
+	var weights []mathx.Float
+	for _, field := range strings.Split(s, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q", field)
+		}
+		weights = append(weights, mathx.Float(w))
+	}
+	return weights, nil
+}
+
+func allZero(weights []mathx.Float) bool {
+	for _, w := range weights {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ClassWeights expands per-class weights to a per-sample weight vector of d
+func ClassWeights(d *Dataset, classWeights []mathx.Float) ([]mathx.Float, error) {
+	if len(classWeights) != d.NumClasses {
+		return nil, fmt.Errorf("%w: %d class weights for %d classes", ErrShape, len(classWeights), d.NumClasses)
+	}
+	weights := make([]mathx.Float, d.Len())
+	for i := range weights {
+		weights[i] = classWeights[d.Label(i)]
+	}
+	return weights, nil
+}
+
+// BalancedWeights returns per-sample weights inversely proportional to the
+// class frequency, n / (classes * count of the class), so that every class
+// contributes equally to the loss and the mean weight is 1
+func BalancedWeights(d *Dataset) []mathx.Float {
+	classes := d.classIndices()
+	nonempty := 0
+	for _, indices := range classes {
+		if len(indices) > 0 {
+			nonempty++
+		}
+	}
+	weights := make([]mathx.Float, d.Len())
+	for _, indices := range classes {
+		for _, i := range indices {
+			weights[i] = mathx.Float(d.Len()) / mathx.Float(nonempty*len(indices))
+		}
+	}
+	return weights
+}
+
+// LossWeights is a parsed loss weights spec which gives per-sample weights of
+// datasets of the same classes
+type LossWeights struct {
+	// Balanced weights are inversely proportional to class frequencies of
+	// each dataset, see BalancedWeights
+	Balanced bool
+	// Classes are weights of classes if not Balanced
+	Classes []mathx.Float
+}
+
+// ParseLossWeights parses a loss weights spec of numClasses classes: balanced
+// or w0,w1,... for per-class weights, nil returned if spec is empty
+func ParseLossWeights(spec string, numClasses int) (*LossWeights, error) {
+	switch spec = strings.TrimSpace(spec); spec {
+	case "":
+		return nil, nil
+	case "balanced":
+		return &LossWeights{Balanced: true}, nil
+	}
+	classWeights, err := parseWeights(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(classWeights) != numClasses {
+		return nil, fmt.Errorf("%w: %d class weights for %d classes", ErrShape, len(classWeights), numClasses)
+	}
+	if allZero(classWeights) {
+		return nil, fmt.Errorf("class weights %q are all 0", spec)
+	}
+	return &LossWeights{Classes: classWeights}, nil
+}
+
+// Of returns per-sample weights of d, nil if w is nil
+func (w *LossWeights) Of(d *Dataset) []mathx.Float {
+	switch {
+	case w == nil:
+		return nil
+	case w.Balanced:
+		return BalancedWeights(d)
+	}
+	weights := make([]mathx.Float, d.Len())
+	for i := range weights {
+		weights[i] = w.Classes[d.Label(i)]
+	}
+	return weights
+}
+
+// ParseClassWeights parses loss weights spec of d: balanced or w0,w1,... for
+// per-class weights, nil returned if spec is empty
+func ParseClassWeights(spec string, d *Dataset) ([]mathx.Float, error) {
+	w, err := ParseLossWeights(spec, d.NumClasses)
+	if err != nil {
+		return nil, err
+	}
+	return w.Of(d), nil
+}
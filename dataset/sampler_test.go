@@ -0,0 +1,148 @@
+package dataset
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+// imbalancedDataset has 90 samples of class 0 and 10 samples of class 1
+func imbalancedDataset() *Dataset {
+	d := &Dataset{Rows: 1, Cols: 1, NumClasses: 3, Images: make([]uint8, 100), Labels: make([]uint8, 100)}
+	for i := 90; i < 100; i++ {
+		d.Labels[i] = 1
+	}
+	return d
+}
+
+func classCounts(d *Dataset, indices []int) []int {
+	counts := make([]int, d.NumClasses)
+	for _, i := range indices {
+		counts[d.Label(i)]++
+	}
+	return counts
+}
+
+func TestSamplers(t *testing.T) {
+	d := imbalancedDataset()
+	rng := rand.New(rand.NewSource(1))
+
+	s := Oversampler{}
+	indices := s.Indices(d, rng)
+	assert.Equal(t, 180, s.Len(d))
+	assert.Equal(t, []int{90, 90, 0}, classCounts(d, indices))
+	seen := make(map[int]bool)
+	for _, i := range indices {
+		seen[i] = true
+	}
+	assert.Equal(t, 100, len(seen))
+
+	counts := make([]int, 3)
+	for k := 0; k < 50; k++ {
+		for label, n := range classCounts(d, (&ClassSampler{}).Indices(d, rng)) {
+			counts[label] += n
+		}
+	}
+	assert.InDelta(t, 2500, counts[0], 200)
+	assert.InDelta(t, 2500, counts[1], 200)
+
+	counts = classCounts(d, (&ClassSampler{ClassWeights: []mathx.Float{1, 3, 5}}).Indices(d, rng))
+	assert.InDelta(t, 25, counts[0], 15)
+	assert.Equal(t, 0, counts[2])
+
+	weights := make([]mathx.Float, 100)
+	weights[5] = 2
+	indices = (&WeightedSampler{Weights: weights}).Indices(d, rng)
+	assert.Equal(t, 100, len(indices))
+	for _, i := range indices {
+		assert.Equal(t, 5, i)
+	}
+}
+
+func TestLossWeights(t *testing.T) {
+	d := imbalancedDataset()
+	weights := BalancedWeights(d)
+	assert.InDelta(t, 100.0/180, float64(weights[0]), 1e-9)
+	assert.InDelta(t, 5, float64(weights[99]), 1e-9)
+	var sum mathx.Float
+	for _, w := range weights {
+		sum += w
+	}
+	assert.InDelta(t, 100, float64(sum), 1e-9)
+
+	weights, err := ParseClassWeights("1, 2, 3", d)
+	if assert.NoError(t, err) {
+		assert.Equal(t, mathx.Float(1), weights[0])
+		assert.Equal(t, mathx.Float(2), weights[99])
+	}
+	_, err = ParseClassWeights("1,2", d)
+	assert.True(t, errors.Is(err, ErrShape), "got %v", err)
+	_, err = ParseClassWeights("1,-2,3", d)
+	assert.Error(t, err)
+	_, err = ParseClassWeights("0,0,0", d)
+	assert.Error(t, err)
+	w, err := ParseLossWeights("balanced", d.NumClasses)
+	if assert.NoError(t, err) {
+		assert.Equal(t, BalancedWeights(d), w.Of(d))
+	}
+	weights, err = ParseClassWeights("", d)
+	assert.NoError(t, err)
+	assert.Nil(t, weights)
+}
+
+func TestParseSampler(t *testing.T) {
+	for spec, want := range map[string]Sampler{
+		"":            nil,
+		"uniform":     nil,
+		"balanced":    &ClassSampler{},
+		"oversample":  Oversampler{},
+		"class=1,0.5": &ClassSampler{ClassWeights: []mathx.Float{1, 0.5}},
+	} {
+		s, err := ParseSampler(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, want, s, spec)
+		}
+	}
+	for _, spec := range []string{"random", "class=", "class=a", "class=0,0"} {
+		_, err := ParseSampler(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLoaderSampler(t *testing.T) {
+	d := imbalancedDataset()
+	l := NewLoader(d, 32, 1)
+	l.Sampler = Oversampler{}
+	l.Weights = BalancedWeights(d)
+	assert.Equal(t, 6, l.NumBatches())
+	total := 0
+	for b := range l.Epoch(context.Background()) {
+		if assert.Equal(t, b.Size(), len(b.Weights)) {
+			for k, i := range b.Indices {
+				assert.Equal(t, l.Weights[i], b.Weights[k])
+			}
+		}
+		total += b.Size()
+	}
+	assert.Equal(t, 180, total)
+
+	assert.NoError(t, l.Check())
+
+	// weights must match the dataset and some must be positive
+	l.Sampler = &WeightedSampler{Weights: make([]mathx.Float, d.Len())}
+	assert.Error(t, l.Check())
+	l.Sampler = &WeightedSampler{Weights: make([]mathx.Float, 5)}
+	assert.True(t, errors.Is(l.Check(), ErrShape))
+	l.Sampler = &ClassSampler{ClassWeights: []mathx.Float{1, 1}}
+	assert.True(t, errors.Is(l.Check(), ErrShape))
+	l.Sampler = &ClassSampler{ClassWeights: []mathx.Float{0, 0, 1}}
+	assert.Error(t, l.Check(), "class 2 has no samples")
+	l.Sampler = &ClassSampler{ClassWeights: []mathx.Float{0, 1, 0}}
+	assert.NoError(t, l.Check())
+	l.Weights = l.Weights[1:]
+	assert.True(t, errors.Is(l.Check(), ErrShape))
+}
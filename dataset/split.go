@@ -0,0 +1,110 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Split shuffles d by seed and splits it into training set with ratio of
+// samples and validation set with the rest.
+func Split(d *Dataset, ratio float64, seed int64) (training, validation *Dataset) {
+	indices := rand.New(rand.NewSource(seed)).Perm(d.Len())
+	n := splitPoint(len(indices), ratio)
+	return d.Subset(sorted(indices[:n])), d.Subset(sorted(indices[n:]))
+}
+
+// StratifiedSplit is like Split but keeps class proportions in both sets
+func StratifiedSplit(d *Dataset, ratio float64, seed int64) (training, validation *Dataset) {
+	rng := rand.New(rand.NewSource(seed))
+	var trainingIndices, validationIndices []int
+	for _, indices := range d.classIndices() {
+		rng.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+		n := splitPoint(len(indices), ratio)
+		trainingIndices = append(trainingIndices, indices[:n]...)
+		validationIndices = append(validationIndices, indices[n:]...)
+	}
+	return d.Subset(sorted(trainingIndices)), d.Subset(sorted(validationIndices))
+}
+
+// classIndices returns indices of samples grouped by class
+func (d *Dataset) classIndices() [][]int {
+	classes := make([][]int, d.NumClasses)
+	for i, label := range d.Labels {
+		classes[label] = append(classes[label], i)
+	}
+	return classes
+}
+
+func splitPoint(n int, ratio float64) int {
+	if ratio <= 0 {
+		return 0
+	}
+	if ratio >= 1 {
+		return n
+	}
+	return int(math.Round(float64(n) * ratio))
+}
+
+func sorted(indices []int) []int {
+	sort.Ints(indices)
+	return indices
+}
+
+// Folds iterates over folds of k-fold cross validation
+//
+//	folds, err := KFold(d, 5, seed)
+//	if err != nil {
+//		...
+//	}
+//	for folds.Next() {
+//		training, validation := folds.Fold()
+//		...
+//	}
+type Folds struct {
+	d     *Dataset
+	folds [][]int
+	i     int
+}
+
+// KFold shuffles d by seed and partitions it into k folds of nearly equal
+// size, an error is returned unless 2 <= k <= d.Len() so that every fold has
+// validation and training samples
+func KFold(d *Dataset, k int, seed int64) (*Folds, error) {
+	if k < 2 || k > d.Len() {
+		return nil, fmt.Errorf("can't split %d samples into %d folds", d.Len(), k)
+	}
+	indices := rand.New(rand.NewSource(seed)).Perm(d.Len())
+	folds := make([][]int, k)
+	for i := range folds {
+		folds[i] = sorted(indices[i*len(indices)/k : (i+1)*len(indices)/k])
+	}
+	return &Folds{d: d, folds: folds, i: -1}, nil
+}
+
+// Len returns number of folds
+func (f *Folds) Len() int { return len(f.folds) }
+
+// Index returns index of the current fold
+func (f *Folds) Index() int { return f.i }
+
+// Next advances to the next fold, false returned after the last fold
+func (f *Folds) Next() bool {
+	if f.i+1 >= len(f.folds) {
+		return false
+	}
+	f.i++
+	return true
+}
+
+// Fold returns the current fold as validation set and other folds as training set
+func (f *Folds) Fold() (training, validation *Dataset) {
+	var trainingIndices []int
+	for i, fold := range f.folds {
+		if i != f.i {
+			trainingIndices = append(trainingIndices, fold...)
+		}
+	}
+	return f.d.Subset(sorted(trainingIndices)), f.d.Subset(f.folds[f.i])
+}
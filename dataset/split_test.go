@@ -0,0 +1,57 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	d := testDataset(100)
+	training, validation := Split(d, 0.8, 1)
+	assert.Equal(t, 80, training.Len())
+	assert.Equal(t, 20, validation.Len())
+
+	training2, _ := Split(d, 0.8, 1)
+	assert.Equal(t, training, training2)
+
+	// 3 of class 0, 1 of class 1
+	d.Labels = d.Labels[:40]
+	d.Images = d.Images[:80]
+	for i := range d.Labels {
+		d.Labels[i] = uint8(i % 4 / 3)
+	}
+	training, validation = StratifiedSplit(d, 0.5, 1)
+	for _, set := range []*Dataset{training, validation} {
+		counts := make([]int, 2)
+		for _, label := range set.Labels {
+			counts[label]++
+		}
+		assert.Equal(t, []int{15, 5}, counts)
+	}
+}
+
+func TestKFold(t *testing.T) {
+	d := testDataset(10)
+	for _, k := range []int{0, 1, 11} {
+		_, err := KFold(d, k, 1)
+		assert.Error(t, err, "%d folds", k)
+	}
+	folds, err := KFold(d, 3, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, folds.Len())
+	seen := make(map[uint8]int)
+	n := 0
+	for folds.Next() {
+		training, validation := folds.Fold()
+		assert.Equal(t, 10, training.Len()+validation.Len())
+		for i := 0; i < validation.Len(); i++ {
+			seen[validation.Image(i)[0]]++
+		}
+		n++
+	}
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 10, len(seen))
+}
@@ -0,0 +1,243 @@
+package dataset
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Stats are statistics of a dataset used to sanity check data before training
+type Stats struct {
+	Count      int
+	Rows, Cols int
+	// Classes is number of samples of each class
+	Classes []int
+	// Mean and Std are per pixel mean and standard deviation in range [0, 1]
+	Mean, Std *Image
+	// ClassMeans is the mean image of each class, nil if the class is empty
+	ClassMeans []*Image
+	Duplicates []Duplicate
+	// Outliers are sorted by descending Score
+	Outliers []Outlier
+}
+
+// Duplicate is a group of samples with identical images
+type Duplicate struct {
+	Indices []int
+	// Conflict is true if the samples have different labels
+	Conflict bool
+}
+
+// Outlier is a sample far from the mean image of its class
+type Outlier struct {
+	Index, Label int
+	// Distance is the euclidean distance to the class mean
+	Distance mathx.Float
+	// Score is the z-score of Distance among samples of the class
+	Score mathx.Float
+}
+
+// DefaultOutlierScore is the z-score above which a sample is an outlier
+const DefaultOutlierScore = 3
+
+// ComputeStats computes statistics of d, samples whose distance to their class
+// mean has z-score above outlierScore are reported as outliers.
+func ComputeStats(d *Dataset, outlierScore mathx.Float) *Stats {
+	size := d.ImageSize()
+	s := &Stats{
+		Count:      d.Len(),
+		Rows:       d.Rows,
+		Cols:       d.Cols,
+		Classes:    make([]int, d.NumClasses),
+		Mean:       NewImage(d.Rows, d.Cols),
+		Std:        NewImage(d.Rows, d.Cols),
+		ClassMeans: make([]*Image, d.NumClasses),
+	}
+
+	sum, sqsum := make([]float64, size), make([]float64, size)
+	classSums := make([][]float64, d.NumClasses)
+	for i := 0; i < d.Len(); i++ {
+		label := d.Label(i)
+		s.Classes[label]++
+		if classSums[label] == nil {
+			classSums[label] = make([]float64, size)
+		}
+		for j, b := range d.Image(i) {
+			x := float64(b) / 255
+			sum[j] += x
+			sqsum[j] += x * x
+			classSums[label][j] += x
+		}
+	}
+	if s.Count > 0 {
+		n := float64(s.Count)
+		for j := range sum {
+			mean := sum[j] / n
+			s.Mean.Pix[j] = mathx.Float(mean)
+			s.Std.Pix[j] = mathx.Float(math.Sqrt(math.Max(0, sqsum[j]/n-mean*mean)))
+		}
+	}
+	for label, classSum := range classSums {
+		if classSum == nil {
+			continue
+		}
+		img := NewImage(d.Rows, d.Cols)
+		for j, x := range classSum {
+			img.Pix[j] = mathx.Float(x / float64(s.Classes[label]))
+		}
+		s.ClassMeans[label] = img
+	}
+
+	s.Duplicates = findDuplicates(d)
+	s.Outliers = findOutliers(d, s.ClassMeans, outlierScore)
+	return s
+}
+
+func findDuplicates(d *Dataset) []Duplicate {
+	buckets := make(map[uint64][]int)
+	h := fnv.New64a()
+	for i := 0; i < d.Len(); i++ {
+		h.Reset()
+		h.Write(d.Image(i))
+		key := h.Sum64()
+		buckets[key] = append(buckets[key], i)
+	}
+	var duplicates []Duplicate
+	for _, bucket := range buckets {
+		// split the bucket by exact equality in case of hash collisions
+		for len(bucket) > 1 {
+			first := d.Image(bucket[0])
+			group, rest := []int{bucket[0]}, bucket[:0:0]
+			for _, i := range bucket[1:] {
+				if bytes.Equal(first, d.Image(i)) {
+					group = append(group, i)
+				} else {
+					rest = append(rest, i)
+				}
+			}
+			if len(group) > 1 {
+				dup := Duplicate{Indices: group}
+				for _, i := range group[1:] {
+					if d.Label(i) != d.Label(group[0]) {
+						dup.Conflict = true
+					}
+				}
+				duplicates = append(duplicates, dup)
+			}
+			bucket = rest
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Indices[0] < duplicates[j].Indices[0]
+	})
+	return duplicates
+}
+
+func findOutliers(d *Dataset, classMeans []*Image, outlierScore mathx.Float) []Outlier {
+	distances := make([]float64, d.Len())
+	for i := range distances {
+		mean := classMeans[d.Label(i)]
+		var sum float64
+		for j, b := range d.Image(i) {
+			diff := float64(b)/255 - float64(mean.Pix[j])
+			sum += diff * diff
+		}
+		distances[i] = math.Sqrt(sum)
+	}
+
+	// mean and standard deviation of distances of each class
+	n := len(classMeans)
+	count, sum, sqsum := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, dist := range distances {
+		label := d.Label(i)
+		count[label]++
+		sum[label] += dist
+		sqsum[label] += dist * dist
+	}
+	var outliers []Outlier
+	for i, dist := range distances {
+		label := d.Label(i)
+		mean := sum[label] / count[label]
+		std := math.Sqrt(math.Max(0, sqsum[label]/count[label]-mean*mean))
+		if std == 0 {
+			continue
+		}
+		if score := (dist - mean) / std; score > float64(outlierScore) {
+			outliers = append(outliers, Outlier{Index: i, Label: label, Distance: mathx.Float(dist), Score: mathx.Float(score)})
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		return outliers[i].Score > outliers[j].Score
+	})
+	return outliers
+}
+
+// Report writes a summary of s to w, class names are used if not nil and at
+// most limit duplicates and outliers are listed
+func (s *Stats) Report(w io.Writer, classNames []string, limit int) {
+	fmt.Fprintf(w, "samples: %d, image size: %dx%d, classes: %d\n", s.Count, s.Rows, s.Cols, len(s.Classes))
+	fmt.Fprintln(w, "class histogram:")
+	for label, n := range s.Classes {
+		name := fmt.Sprint(label)
+		if label < len(classNames) {
+			name = classNames[label]
+		}
+		var percent float64
+		if s.Count > 0 {
+			percent = float64(n) / float64(s.Count) * 100
+		}
+		fmt.Fprintf(w, "  %-6s %8d %6.2f%%\n", name, n, percent)
+	}
+
+	var mean, std mathx.Float
+	constant := 0
+	for j := range s.Mean.Pix {
+		mean += s.Mean.Pix[j]
+		std += s.Std.Pix[j]
+		if s.Std.Pix[j] == 0 {
+			constant++
+		}
+	}
+	if size := len(s.Mean.Pix); size > 0 {
+		mean, std = mean/mathx.Float(size), std/mathx.Float(size)
+	}
+	fmt.Fprintf(w, "pixels: mean = %.4f, std = %.4f (averaged over pixels), %d constant pixels\n", mean, std, constant)
+
+	duplicated, conflicts := 0, 0
+	for _, dup := range s.Duplicates {
+		duplicated += len(dup.Indices) - 1
+		if dup.Conflict {
+			conflicts++
+		}
+	}
+	fmt.Fprintf(w, "duplicates: %d groups, %d redundant samples, %d groups with conflicting labels\n", len(s.Duplicates), duplicated, conflicts)
+	for i, dup := range s.Duplicates {
+		if i >= limit {
+			fmt.Fprintf(w, "  ...\n")
+			break
+		}
+		conflict := ""
+		if dup.Conflict {
+			conflict = " (conflicting labels)"
+		}
+		fmt.Fprintf(w, "  %v%s\n", dup.Indices, conflict)
+	}
+
+	fmt.Fprintf(w, "outliers: %d\n", len(s.Outliers))
+	for i, o := range s.Outliers {
+		if i >= limit {
+			fmt.Fprintf(w, "  ...\n")
+			break
+		}
+		name := fmt.Sprint(o.Label)
+		if o.Label < len(classNames) {
+			name = classNames[o.Label]
+		}
+		fmt.Fprintf(w, "  index %d, class %s, distance = %.4f, score = %.2f\n", o.Index, name, o.Distance, o.Score)
+	}
+}
@@ -0,0 +1,55 @@
+package dataset
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeStats(t *testing.T) {
+	d := &Dataset{Rows: 1, Cols: 2, NumClasses: 3}
+	add := func(a, b uint8, label uint8) {
+		d.Images = append(d.Images, a, b)
+		d.Labels = append(d.Labels, label)
+	}
+	for i := 0; i < 20; i++ {
+		add(uint8(100+i%3), 0, 0)
+	}
+	add(255, 255, 0) // outlier, index 20
+	add(100, 0, 1)   // duplicate of 0 with conflicting label, index 21
+	add(102, 0, 0)   // duplicate of 2, index 22
+
+	s := ComputeStats(d, DefaultOutlierScore)
+	assert.Equal(t, 23, s.Count)
+	assert.Equal(t, []int{22, 1, 0}, s.Classes)
+	assert.Nil(t, s.ClassMeans[2])
+	assert.InDelta(t, 0, float64(s.ClassMeans[1].Pix[1]), 1e-9)
+	assert.InDelta(t, 100.0/255, float64(s.ClassMeans[1].Pix[0]), 1e-9)
+	assert.InDelta(t, 255.0/255/23, float64(s.Mean.Pix[1]), 1e-6)
+	assert.True(t, s.Std.Pix[1] > 0)
+
+	if assert.Equal(t, 3, len(s.Duplicates)) {
+		assert.Equal(t, Duplicate{Indices: []int{0, 3, 6, 9, 12, 15, 18, 21}, Conflict: true}, s.Duplicates[0])
+		assert.Equal(t, []int{1, 4, 7, 10, 13, 16, 19}, s.Duplicates[1].Indices)
+		assert.False(t, s.Duplicates[2].Conflict)
+	}
+	if assert.Equal(t, 1, len(s.Outliers)) {
+		assert.Equal(t, 20, s.Outliers[0].Index)
+		assert.Equal(t, 0, s.Outliers[0].Label)
+		assert.True(t, s.Outliers[0].Score > DefaultOutlierScore)
+	}
+
+	var buf bytes.Buffer
+	s.Report(&buf, []string{"zero", "one", "two"}, 1)
+	out := buf.String()
+	assert.True(t, strings.Contains(out, "samples: 23"), out)
+	assert.True(t, strings.Contains(out, "3 groups, 19 redundant samples, 1 groups with conflicting labels"), out)
+	assert.True(t, strings.Contains(out, "index 20, class zero"), out)
+
+	empty := ComputeStats(&Dataset{Rows: 2, Cols: 2, NumClasses: 2}, mathx.Float(DefaultOutlierScore))
+	assert.Equal(t, 0, empty.Count)
+	assert.Equal(t, 0, len(empty.Outliers))
+}
@@ -0,0 +1,211 @@
+// Package synth generates MNIST-like datasets of digit glyphs for offline tests
+package synth
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/dataset/idx"
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Options controls variation of generated glyphs
+type Options struct {
+	// Rows and Cols of images, 28x28 if zero
+	Rows, Cols int
+	// Noise is standard deviation of gaussian pixel noise in range [0, 1]
+	Noise float64
+	// Jitter is the max shift of glyphs in pixels
+	Jitter float64
+	// Rotation is the max rotation of glyphs in radians
+	Rotation float64
+	// Scale is the max relative change of glyph size
+	Scale float64
+	// MinStroke and MaxStroke are range of stroke width in pixels
+	MinStroke, MaxStroke float64
+}
+
+// DefaultOptions are moderate variations which keep glyphs recognizable
+var DefaultOptions = Options{
+	Rows:      28,
+	Cols:      28,
+	Noise:     0.05,
+	Jitter:    2,
+	Rotation:  0.2,
+	Scale:     0.1,
+	MinStroke: 1.5,
+	MaxStroke: 3,
+}
+
+// Generator renders random digit glyphs
+type Generator struct {
+	opts Options
+	rng  *rand.Rand
+}
+
+// New creates a generator, generated images are determined by seed
+func New(seed int64, opts Options) *Generator {
+	if opts.Rows <= 0 || opts.Cols <= 0 {
+		opts.Rows, opts.Cols = 28, 28
+	}
+	if opts.MaxStroke < opts.MinStroke {
+		opts.MaxStroke = opts.MinStroke
+	}
+	return &Generator{opts: opts, rng: rand.New(rand.NewSource(seed))}
+}
+
+type point struct{ x, y float64 }
+
+// arc returns points of an elliptic arc centered at (cx, cy) from angle a0
+// to a1 in turns, angle 0 points right and angles grow clockwise
+func arc(cx, cy, rx, ry, a0, a1 float64) []point {
+	const n = 12
+	points := make([]point, n+1)
+	for i := range points {
+		a := 2 * math.Pi * (a0 + (a1-a0)*float64(i)/n)
+		points[i] = point{cx + rx*math.Cos(a), cy + ry*math.Sin(a)}
+	}
+	return points
+}
+
+func line(points ...float64) []point {
+	result := make([]point, len(points)/2)
+	for i := range result {
+		result[i] = point{points[2*i], points[2*i+1]}
+	}
+	return result
+}
+
+func join(parts ...[]point) []point {
+	var result []point
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
+
+// glyphs are polylines of digits in the unit box, x grows right and y grows down
+var glyphs = [10][][]point{
+	{arc(0.5, 0.5, 0.32, 0.48, 0, 1)},
+	{line(0.3, 0.2, 0.55, 0, 0.55, 1)},
+	{join(arc(0.5, 0.28, 0.3, 0.26, 0.5, 1.05), line(0.78, 0.4, 0.15, 1, 0.85, 1))},
+	{arc(0.48, 0.26, 0.3, 0.24, 0.55, 1.25), arc(0.48, 0.74, 0.32, 0.26, 0.75, 1.45)},
+	{line(0.65, 1, 0.65, 0, 0.1, 0.7, 0.9, 0.7)},
+	{join(line(0.85, 0, 0.25, 0, 0.2, 0.45), arc(0.48, 0.68, 0.32, 0.3, 0.65, 1.4))},
+	{join(line(0.75, 0.02, 0.25, 0.6), arc(0.5, 0.72, 0.28, 0.27, 0.5, 1.5))},
+	{line(0.15, 0, 0.85, 0, 0.4, 1)},
+	{arc(0.5, 0.25, 0.25, 0.24, 0, 1), arc(0.5, 0.73, 0.3, 0.26, 0, 1)},
+	{join(arc(0.5, 0.3, 0.28, 0.28, 0, 1), line(0.78, 0.3, 0.6, 1))},
+}
+
+// Digit renders a random glyph of digit label in range [0, 9]
+func (g *Generator) Digit(label int) *dataset.Image {
+	o, rng := g.opts, g.rng
+	img := dataset.NewImage(o.Rows, o.Cols)
+
+	// map the unit box to a 20x20 box like MNIST, with random rotation,
+	// scale and translation
+	size := math.Min(float64(o.Rows), float64(o.Cols)) * 20 / 28
+	scale := size * (1 + o.Scale*(2*rng.Float64()-1))
+	angle := o.Rotation * (2*rng.Float64() - 1)
+	sin, cos := math.Sin(angle), math.Cos(angle)
+	cx := float64(o.Cols)/2 + o.Jitter*(2*rng.Float64()-1)
+	cy := float64(o.Rows)/2 + o.Jitter*(2*rng.Float64()-1)
+	transform := func(p point) point {
+		x, y := (p.x-0.5)*scale*0.8, (p.y-0.5)*scale
+		return point{cx + x*cos - y*sin, cy + x*sin + y*cos}
+	}
+	width := o.MinStroke + (o.MaxStroke-o.MinStroke)*rng.Float64()
+
+	var segments [][2]point
+	for _, polyline := range glyphs[label] {
+		for i := 1; i < len(polyline); i++ {
+			segments = append(segments, [2]point{transform(polyline[i-1]), transform(polyline[i])})
+		}
+	}
+	for r := 0; r < o.Rows; r++ {
+		for c := 0; c < o.Cols; c++ {
+			p := point{float64(c) + 0.5, float64(r) + 0.5}
+			dist := math.Inf(1)
+			for _, s := range segments {
+				dist = math.Min(dist, distance(p, s[0], s[1]))
+			}
+			// anti-aliased stroke edge of 1 pixel
+			x := clamp(width/2+0.5-dist) + o.Noise*rng.NormFloat64()
+			img.Pix[r*o.Cols+c] = mathx.Float(clamp(x))
+		}
+	}
+	return img
+}
+
+// Dataset generates n samples with labels cycling through 0 to 9 in random order
+func (g *Generator) Dataset(n int) *dataset.Dataset {
+	o := g.opts
+	d := &dataset.Dataset{
+		Rows:       o.Rows,
+		Cols:       o.Cols,
+		NumClasses: 10,
+		Images:     make([]uint8, 0, n*o.Rows*o.Cols),
+		Labels:     make([]uint8, n),
+	}
+	for i, j := range g.rng.Perm(n) {
+		d.Labels[i] = uint8(j % 10)
+	}
+	for _, label := range d.Labels {
+		for _, x := range g.Digit(int(label)).Pix {
+			d.Images = append(d.Images, uint8(math.Round(float64(x)*255)))
+		}
+	}
+	return d
+}
+
+// WriteIDX writes images and labels of d as IDX files, files are gzip
+// compressed if their names end with .gz
+func WriteIDX(d *dataset.Dataset, imageFile, labelFile string) error {
+	images := &idx.Tensor{Type: idx.Uint8, Dims: []int{d.Len(), d.Rows, d.Cols}, Data: d.Images}
+	if err := idx.WriteFile(imageFile, images); err != nil {
+		return err
+	}
+	labels := &idx.Tensor{Type: idx.Uint8, Dims: []int{d.Len()}, Data: d.Labels}
+	return idx.WriteFile(labelFile, labels)
+}
+
+// Info describes datasets written by WriteMNIST, it has no checksums so that
+// generated files can be served as a remote dataset. It isn't registered.
+var Info = &dataset.Info{
+	Name:           "synth",
+	TrainingImages: dataset.MNIST.TrainingImages,
+	TrainingLabels: dataset.MNIST.TrainingLabels,
+	TestImages:     dataset.MNIST.TestImages,
+	TestLabels:     dataset.MNIST.TestLabels,
+	NumClasses:     10,
+	ClassNames:     dataset.MNIST.ClassNames,
+}
+
+// WriteMNIST generates training and test sets with given number of samples
+// and writes them to dir with MNIST file names
+func WriteMNIST(dir string, numTraining, numTest int, seed int64, opts Options) error {
+	g := New(seed, opts)
+	info := Info
+	if err := WriteIDX(g.Dataset(numTraining), filepath.Join(dir, info.TrainingImages), filepath.Join(dir, info.TrainingLabels)); err != nil {
+		return err
+	}
+	return WriteIDX(g.Dataset(numTest), filepath.Join(dir, info.TestImages), filepath.Join(dir, info.TestLabels))
+}
+
+// distance returns distance from p to segment ab
+func distance(p, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/l))
+	}
+	x, y := a.x+t*dx-p.x, a.y+t*dy-p.y
+	return math.Sqrt(x*x + y*y)
+}
+
+func clamp(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
@@ -0,0 +1,46 @@
+package synth
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator(t *testing.T) {
+	d := New(1, DefaultOptions).Dataset(100)
+	assert.Equal(t, 100, d.Len())
+	assert.Equal(t, 28*28, d.ImageSize())
+	assert.Equal(t, d, New(1, DefaultOptions).Dataset(100))
+	assert.NotEqual(t, d, New(2, DefaultOptions).Dataset(100))
+
+	counts := make([]int, 10)
+	for i := 0; i < d.Len(); i++ {
+		counts[d.Label(i)]++
+		// strokes are drawn in the middle of the image, borders are nearly black
+		img := d.ImageOf(i)
+		var ink float64
+		for _, x := range img.Pix {
+			ink += float64(x)
+		}
+		assert.True(t, ink > 20, "image %d has no stroke", i)
+		assert.True(t, img.At(0, 0) < 0.5)
+	}
+	for _, n := range counts {
+		assert.Equal(t, 10, n)
+	}
+}
+
+func TestWriteMNIST(t *testing.T) {
+	dir := t.TempDir()
+	if !assert.NoError(t, WriteMNIST(dir, 20, 10, 1, Options{Rows: 8, Cols: 8, MinStroke: 1})) {
+		return
+	}
+	training, test, err := Info.LoadFS(context.Background(), os.DirFS(dir))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 20, training.Len())
+		assert.Equal(t, 10, test.Len())
+		assert.Equal(t, 8, test.Rows)
+	}
+}
@@ -0,0 +1,179 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Transform transforms an image for data augmentation, random parameters are drawn from rng
+type Transform interface {
+	Apply(img *Image, rng *rand.Rand) *Image
+}
+
+// TransformFunc adapts a function to Transform
+type TransformFunc func(img *Image, rng *rand.Rand) *Image
+
+func (f TransformFunc) Apply(img *Image, rng *rand.Rand) *Image { return f(img, rng) }
+
+// Compose applies transforms in order
+func Compose(transforms ...Transform) Transform {
+	return TransformFunc(func(img *Image, rng *rand.Rand) *Image {
+		for _, t := range transforms {
+			img = t.Apply(img, rng)
+		}
+		return img
+	})
+}
+
+// RandomAffine applies a random affine transform about the image center with
+// bilinear resampling. Each parameter is drawn uniformly from its range.
+type RandomAffine struct {
+	Shift    float64 // translation in [-Shift, Shift] pixels along each axis
+	Rotation float64 // rotation in [-Rotation, Rotation] degrees
+	Scale    float64 // scaling factor in [1-Scale, 1+Scale]
+	Shear    float64 // horizontal shear in [-Shear, Shear] degrees
+}
+
+func Translation(shift float64) RandomAffine { return RandomAffine{Shift: shift} }
+func Rotation(degrees float64) RandomAffine  { return RandomAffine{Rotation: degrees} }
+func Scaling(scale float64) RandomAffine     { return RandomAffine{Scale: scale} }
+func Shearing(degrees float64) RandomAffine  { return RandomAffine{Shear: degrees} }
+
+// uniform returns a random number in [-x, x)
+func uniform(rng *rand.Rand, x float64) float64 { return (rng.Float64()*2 - 1) * x }
+
+func (t RandomAffine) Apply(img *Image, rng *rand.Rand) *Image {
+	var (
+		tx, ty = uniform(rng, t.Shift), uniform(rng, t.Shift)
+		theta  = uniform(rng, t.Rotation) * math.Pi / 180
+		scale  = 1 + uniform(rng, t.Scale)
+		shear  = math.Tan(uniform(rng, t.Shear) * math.Pi / 180)
+	)
+	// forward transform: p' = S*R*H*(p-center) + center + t,
+	// output pixels are sampled from the inverse transformed positions
+	sin, cos := math.Sincos(theta)
+	a, b := scale*cos, scale*(cos*shear-sin)
+	c, d := scale*sin, scale*(sin*shear+cos)
+	det := a*d - b*c
+	ia, ib, ic, id := d/det, -b/det, -c/det, a/det
+
+	out := NewImage(img.Rows, img.Cols)
+	cy, cx := float64(img.Rows-1)/2, float64(img.Cols-1)/2
+	for r := 0; r < img.Rows; r++ {
+		for col := 0; col < img.Cols; col++ {
+			x, y := float64(col)-cx-tx, float64(r)-cy-ty
+			out.Pix[r*img.Cols+col] = img.Bilinear(ic*x+id*y+cy, ia*x+ib*y+cx)
+		}
+	}
+	return out
+}
+
+// Elastic applies elastic distortion described by Simard et al. 2003: a
+// random displacement field is smoothed by a gaussian filter with standard
+// deviation Sigma and scaled by Alpha.
+type Elastic struct {
+	Alpha float64
+	Sigma float64
+}
+
+func (t Elastic) Apply(img *Image, rng *rand.Rand) *Image {
+	n := img.Rows * img.Cols
+	dx, dy := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		dx[i], dy[i] = uniform(rng, 1), uniform(rng, 1)
+	}
+	kernel := gaussianKernel(t.Sigma)
+	dx = smooth(dx, img.Rows, img.Cols, kernel)
+	dy = smooth(dy, img.Rows, img.Cols, kernel)
+
+	out := NewImage(img.Rows, img.Cols)
+	for r := 0; r < img.Rows; r++ {
+		for c := 0; c < img.Cols; c++ {
+			i := r*img.Cols + c
+			out.Pix[i] = img.Bilinear(float64(r)+t.Alpha*dy[i], float64(c)+t.Alpha*dx[i])
+		}
+	}
+	return out
+}
+
+func gaussianKernel(sigma float64) []float64 {
+	if sigma <= 0 {
+		return []float64{1}
+	}
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - radius)
+		kernel[i] = math.Exp(-x * x / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// smooth convolves a rows x cols field with kernel along both axes, zero padded
+func smooth(field []float64, rows, cols int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	tmp := make([]float64, len(field))
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			var sum float64
+			for k, w := range kernel {
+				if cc := c + k - radius; cc >= 0 && cc < cols {
+					sum += w * field[r*cols+cc]
+				}
+			}
+			tmp[r*cols+c] = sum
+		}
+	}
+	out := make([]float64, len(field))
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			var sum float64
+			for k, w := range kernel {
+				if rr := r + k - radius; rr >= 0 && rr < rows {
+					sum += w * tmp[rr*cols+c]
+				}
+			}
+			out[r*cols+c] = sum
+		}
+	}
+	return out
+}
+
+// ParseTransform parses comma separated augmentations: affine, shift,
+// rotate, scale, shear and elastic, each with default parameters.
+func ParseTransform(spec string) (Transform, error) {
+	var transforms []Transform
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "affine":
+			transforms = append(transforms, RandomAffine{Shift: 2, Rotation: 15, Scale: 0.1, Shear: 10})
+		case "shift":
+			transforms = append(transforms, Translation(2))
+		case "rotate":
+			transforms = append(transforms, Rotation(15))
+		case "scale":
+			transforms = append(transforms, Scaling(0.1))
+		case "shear":
+			transforms = append(transforms, Shearing(10))
+		case "elastic":
+			transforms = append(transforms, Elastic{Alpha: 34, Sigma: 4})
+		default:
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+	}
+	switch len(transforms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return transforms[0], nil
+	}
+	return Compose(transforms...), nil
+}
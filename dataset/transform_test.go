@@ -0,0 +1,89 @@
+package dataset
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func squareImage() *Image {
+	img := NewImage(9, 9)
+	for r := 3; r < 6; r++ {
+		for c := 3; c < 6; c++ {
+			img.Pix[r*9+c] = 1
+		}
+	}
+	return img
+}
+
+func TestRandomAffine(t *testing.T) {
+	img := squareImage()
+	rng := rand.New(rand.NewSource(1))
+	assert.Equal(t, img, RandomAffine{}.Apply(img, rng))
+
+	// shift by exactly 2 pixels
+	out := RandomAffine{Shift: 2}.Apply(img, rand.New(constSource(1<<63-1<<10)))
+	assert.InDelta(t, 1, float64(out.At(5, 5)), 1e-3)
+	assert.InDelta(t, 0, float64(out.At(3, 3)), 1e-3)
+
+	// rotating a centered square by 90 degrees keeps it
+	out = RandomAffine{Rotation: 90}.Apply(img, rand.New(constSource(1<<63-1<<10)))
+	for i := range img.Pix {
+		assert.InDelta(t, float64(img.Pix[i]), float64(out.Pix[i]), 1e-6)
+	}
+}
+
+func TestElastic(t *testing.T) {
+	img := squareImage()
+	out := Elastic{Alpha: 0, Sigma: 4}.Apply(img, rand.New(rand.NewSource(1)))
+	assert.Equal(t, img, out)
+	out = Elastic{Alpha: 8, Sigma: 2}.Apply(img, rand.New(rand.NewSource(1)))
+	assert.NotEqual(t, img, out)
+	for _, x := range out.Pix {
+		assert.True(t, x >= 0 && x <= 1)
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	tr, err := ParseTransform("")
+	assert.NoError(t, err)
+	assert.Nil(t, tr)
+	tr, err = ParseTransform("affine, elastic")
+	assert.NoError(t, err)
+	assert.NotNil(t, tr)
+	_, err = ParseTransform("flip")
+	assert.Error(t, err)
+}
+
+func TestLoaderTransform(t *testing.T) {
+	d := testDataset(4)
+	l := NewLoader(d, 2, 1)
+	l.Transform = TransformFunc(func(img *Image, rng *rand.Rand) *Image {
+		for i := range img.Pix {
+			img.Pix[i] = 1 - img.Pix[i]
+		}
+		return img
+	})
+	for _, stacked := range []bool{false, true} {
+		l.Stacked = stacked
+		for b := range l.Epoch(context.Background()) {
+			for k, i := range b.Indices {
+				input := d.Input(i).Map(func(x mathx.Float) mathx.Float { return 1 - x })
+				if stacked {
+					assert.True(t, input.Equal(b.Inputs.Col(k)))
+				} else {
+					assert.True(t, input.Equal(b.Samples[k].Input))
+				}
+			}
+		}
+	}
+}
+
+// constSource always returns the same value
+type constSource int64
+
+func (s constSource) Int63() int64 { return int64(s) }
+func (s constSource) Seed(int64)   {}
@@ -1,201 +1,423 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/mkideal/mnist/dataset"
 	"github.com/mkideal/mnist/mathx"
+	"github.com/mkideal/mnist/nn"
 )
 
-func joinFilename(path, filename string) string {
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		if strings.HasSuffix(path, "/") {
-			return path + filename
+var commands = map[string]func(args []string) error{
+	"cache":   cacheCommand,
+	"convert": convertCommand,
+	"inspect": inspectCommand,
+	"predict": predictCommand,
+}
+
+func main() {
+	var err error
+	if cmd, ok := commands[commandName()]; ok {
+		err = cmd(os.Args[2:])
+	} else {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = run(ctx, os.Args[1:])
+		stop()
+	}
+	if err != nil {
+		if err != errFlags {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if errors.As(err, new(usageError)) {
+			os.Exit(2)
 		}
-		return path + "/" + filename
+		os.Exit(1)
 	}
-	return filepath.Join(path, filename)
 }
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
+// commandName returns the first argument which may name a command
+func commandName() string {
+	if len(os.Args) > 1 {
+		return os.Args[1]
+	}
+	return ""
+}
 
-	flDatasetPath := flag.String("d", "http://yann.lecun.com/exdb/mnist", "mnist dataset path or remote root URL")
-	flag.Parse()
+// usageError reports invalid command line arguments
+type usageError struct{ error }
 
-	var (
-		trainingImageFile = joinFilename(*flDatasetPath, "train-images-idx3-ubyte.gz")
-		trainingLabelFile = joinFilename(*flDatasetPath, "train-labels-idx1-ubyte.gz")
-		testImageFile     = joinFilename(*flDatasetPath, "t10k-images-idx3-ubyte.gz")
-		testLabelFile     = joinFilename(*flDatasetPath, "t10k-labels-idx1-ubyte.gz")
-	)
+// errFlags is returned if flags can't be parsed, the flag set has reported
+// the error and usage
+var errFlags = usageError{errors.New("invalid flags")}
 
-	net := NewNetwork([]int{28 * 28, 24, 10})
+func usagef(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
 
-	// read training data
-	trainingdata, err := dataset.ReadTrainingSet(trainingImageFile, trainingLabelFile)
-	if err != nil {
-		panic(err)
+// useCache configures the default downloader and binary cache by flags, it
+// returns a function restoring them so that flags of a call don't leak into
+// later calls in the same process
+func useCache(cacheDir string, offline, binaryCache bool) (restore func()) {
+	downloader, cache := *dataset.DefaultDownloader, *dataset.DefaultBinaryCache
+	dataset.DefaultDownloader.CacheDir = cacheDir
+	dataset.DefaultDownloader.Offline = offline
+	dataset.DefaultBinaryCache.Disabled = !binaryCache
+	return func() {
+		*dataset.DefaultDownloader, *dataset.DefaultBinaryCache = downloader, cache
 	}
-	trainingdata, _ = dataset.SplitTrainingSet(trainingdata)
+}
 
-	// read test data
-	testdata, err := dataset.ReadTestSet(testImageFile, testLabelFile)
+// run reads a dataset, trains a network and evaluates it as specified by
+// command line arguments
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flDataset := fs.String("dataset", dataset.MNIST.Name, "dataset name: "+strings.Join(dataset.Names(), ", "))
+	flDatasetPath := fs.String("d", "", "dataset path or remote root URL (default URL of the dataset)")
+	flCacheDir := fs.String("cache", "", "cache directory of downloaded files (default $"+dataset.CacheDirEnv+" or user cache directory)")
+	flOffline := fs.Bool("offline", false, "don't download, fail if dataset files are not cached")
+	flBinaryCache := fs.Bool("bincache", true, "cache decoded datasets as binary files which are memory-mapped by later runs")
+	flSplit := fs.Float64("split", 5.0/6, "ratio of training samples used for training, the rest is used for validation")
+	flStratify := fs.Bool("stratify", false, "keep class proportions when splitting training and validation set")
+	flKFold := fs.Int("kfold", 0, "run k-fold cross validation on training set instead of training")
+	flAugment := fs.String("augment", "", "comma separated augmentations applied to training images: affine, shift, rotate, scale, shear, elastic")
+	flAugmentPreview := fs.String("augment-preview", "", "write augmented training samples as PNG files to the directory and exit")
+	flAugmentPreviewNum := fs.Int("augment-preview-n", 32, "number of samples written by -augment-preview")
+	flSampler := fs.String("sampler", "", "training sampler: uniform, balanced, oversample or class=w0,w1,... for per-class sampling weights")
+	flClassWeights := fs.String("class-weights", "", "loss weights of classes: balanced or w0,w1,...")
+	flLabelNoise := fs.String("label-noise", "", "flip labels of training samples and report accuracy on corrupted and clean samples: uniform=rate, pair=rate or confusion=rate:matrix.json")
+	flPreprocess := fs.String("preprocess", "", "comma separated preprocessing steps fitted on training set: deskew, binarize[=threshold], standardize, global-standardize, zca[=epsilon]")
+	flOutput := fs.String("o", "", "save trained model to file")
+	flCheckpoint := fs.String("checkpoint", "", "save network and optimizer state to file after each epoch")
+	flResume := fs.String("resume", "", "resume training from a checkpoint file, its saved config is used if -config is not set")
+	flQuantize := fs.String("q", "", "quantize trained network to int8 and report accuracy difference: layer or row")
+	flConfig := fs.String("config", "", "JSON or YAML training config file, flags override its fields")
+	flagConfig := DefaultConfig
+	flagConfig.flags(fs)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return errFlags
+	}
+
+	cfg := DefaultConfig
+	configFilename := *flConfig
+	if configFilename == "" && *flResume != "" {
+		// the saved config has the seed and learning rate of the checkpoint
+		if _, err := os.Stat(configFile(*flResume)); err == nil {
+			configFilename = configFile(*flResume)
+		}
+	}
+	if configFilename != "" {
+		if err := cfg.ReadFile(configFilename); err != nil {
+			return usageError{err}
+		}
+	}
+	cfg.override(fs)
+	loss, _, err := cfg.validate()
+	if err != nil {
+		return usageError{err}
+	}
+	optimizer, err := cfg.newOptimizer()
+	if err != nil {
+		return usageError{err}
+	}
+	scheduler, err := cfg.newScheduler()
 	if err != nil {
-		panic(err)
+		return usageError{err}
 	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.LearningRate == 0 {
+		cfg.LearningRate = float64(nn.DefaultOptimizerLearningRate(loss, optimizer))
+	}
+	seed := cfg.Seed
+	rand.Seed(seed)
 
-	// train(and test)
-	net.train(trainingdata, testdata, 4)
-}
+	defer useCache(*flCacheDir, *flOffline, *flBinaryCache)()
 
-type Network struct {
-	weights     []*mathx.Matrix
-	biases      []*mathx.Matrix
-	actfuncs    []mathx.UnaryFunction
-	actderfuncs []mathx.UnaryFunction
-}
+	var granularity mathx.QuantGranularity
+	switch *flQuantize {
+	case "":
+	case "layer":
+		granularity = mathx.PerTensor
+	case "row":
+		granularity = mathx.PerRow
+	default:
+		return usagef("invalid quantization granularity %q", *flQuantize)
+	}
 
-func NewNetwork(numNodes []int) *Network {
-	net := new(Network)
-	n := len(numNodes) - 1
-	net.weights = make([]*mathx.Matrix, n)
-	net.biases = make([]*mathx.Matrix, n)
-	net.actfuncs = make([]mathx.UnaryFunction, n)
-	net.actderfuncs = make([]mathx.UnaryFunction, n)
-	for i := 0; i < n; i++ {
-		net.weights[i] = mathx.NewMatrix(numNodes[i+1], numNodes[i]).RandInit(-0.001, 0.001)
-		net.biases[i] = mathx.NewMatrix(numNodes[i+1], 1).RandInit(-0.001, 0.001)
-		if i+1 == n {
-			net.actfuncs[i] = mathx.Sigmoid
-			net.actderfuncs[i] = mathx.SigmoidPrime
-		} else {
-			net.actfuncs[i] = mathx.Sigmoid
-			net.actderfuncs[i] = mathx.SigmoidPrime
-		}
-	}
-	return net
-}
+	transform, err := dataset.ParseTransform(*flAugment)
+	if err != nil {
+		return usageError{err}
+	}
+	sampler, err := dataset.ParseSampler(*flSampler)
+	if err != nil {
+		return usageError{err}
+	}
+	preprocess, err := dataset.ParsePipeline(*flPreprocess)
+	if err != nil {
+		return usageError{err}
+	}
 
-func (net *Network) train(dataSet, testdata []*dataset.Sample, eta mathx.Float) {
-	var (
-		times         = 10
-		miniBatchSize = len(dataSet) / 6000
-	)
-	for i := 0; i < times; i++ {
-		shuffle(dataSet)
-		for j := 0; j+miniBatchSize < len(dataSet); j += miniBatchSize {
-			net.updateMiniBatch(dataSet[j:j+miniBatchSize], eta)
+	info, ok := dataset.Lookup(*flDataset)
+	if !ok {
+		return usagef("unknown dataset %q, available datasets: %s", *flDataset, strings.Join(dataset.Names(), ", "))
+	}
+	if s, ok := sampler.(*dataset.ClassSampler); ok && s.ClassWeights != nil && len(s.ClassWeights) != info.NumClasses {
+		return usagef("%d sampling weights for %d classes", len(s.ClassWeights), info.NumClasses)
+	}
+	lossWeights, err := dataset.ParseLossWeights(*flClassWeights, info.NumClasses)
+	if err != nil {
+		return usageError{err}
+	}
+	noise, err := dataset.ParseLabelNoise(*flLabelNoise, info.NumClasses)
+	if err != nil {
+		return usageError{err}
+	}
+	if *flKFold == 0 && *flSplit >= 1 && nn.NeedsValidation(scheduler) {
+		return usagef("learning rate schedule %s requires a validation set, -split must be less than 1", scheduler)
+	}
+	if *flKFold > 0 {
+		switch {
+		case *flKFold < 2:
+			return usagef("-kfold requires at least 2 folds")
+		case noise != nil:
+			return usagef("-label-noise can't be used with -kfold")
+		case *flCheckpoint != "" || *flResume != "":
+			return usagef("-checkpoint and -resume can't be used with -kfold")
+		}
+	}
+	var checkpoint *nn.Checkpoint
+	if *flResume != "" {
+		if checkpoint, err = nn.LoadCheckpoint(*flResume); err != nil {
+			return err
 		}
-		if len(testdata) > 0 {
-			accuracy := net.evaluate(testdata)
-			fmt.Printf("epoch %2d: accuracy = %.2f%%\n", i+1, accuracy*100)
+		if checkpoint.Optimizer == nil {
+			// a model saved by -o, its training continues with a fresh
+			// optimizer
+			checkpoint.Optimizer = optimizer
+		} else if checkpoint.Optimizer.String() != optimizer.String() {
+			return usagef("checkpoint has optimizer %s, config has %s", checkpoint.Optimizer, optimizer)
+		}
+		if checkpoint.Scheduler == nil {
+			checkpoint.Scheduler = scheduler
+		} else if scheduler == nil || checkpoint.Scheduler.String() != scheduler.String() {
+			return usagef("checkpoint has learning rate schedule %s, config has %q", checkpoint.Scheduler, cfg.LRSchedule)
+		} else if checkpoint.Epochs != 0 && checkpoint.Epochs != cfg.Epochs {
+			// the schedule depends on the total number of epochs
+			return usagef("checkpoint has a learning rate schedule of %d epochs, config has %d epochs", checkpoint.Epochs, cfg.Epochs)
+		}
+		checkpoint.Epochs = cfg.Epochs
+	}
+	root := *flDatasetPath
+	if root == "" {
+		if root = info.URL; root == "" {
+			return usagef("dataset %s can't be downloaded, please specify its local path by -d", info.Name)
 		}
 	}
-}
 
-func (net *Network) updateMiniBatch(dataSet []*dataset.Sample, eta mathx.Float) {
-	n := len(net.weights)
-	eta /= mathx.Float(len(dataSet))
-	nablaWeights := make([]*mathx.Matrix, n)
-	nablaBiases := make([]*mathx.Matrix, n)
-	for i := 0; i < n; i++ {
-		nablaWeights[i] = mathx.NewMatrix(net.weights[i].RowCount(), net.weights[i].ColCount())
-		nablaBiases[i] = mathx.NewMatrix(net.biases[i].RowCount(), 1)
+	// read training data
+	trainingset, err := info.LoadTrainingSet(ctx, root)
+	if err != nil {
+		return err
 	}
-	deltaNablaWeights := make([]*mathx.Matrix, n)
-	deltaNablaBiases := make([]*mathx.Matrix, n)
-	for i := 0; i < n; i++ {
-		deltaNablaWeights[i] = mathx.NewMatrix(net.weights[i].RowCount(), net.weights[i].ColCount())
-		deltaNablaBiases[i] = mathx.NewMatrix(net.biases[i].RowCount(), 1)
+
+	loaderConfig := loaderConfig{transform: transform, sampler: sampler, lossWeights: lossWeights}
+
+	if *flAugmentPreview != "" {
+		return writeAugmentPreview(*flAugmentPreview, trainingset, transform, *flAugmentPreviewNum, seed)
 	}
-	for _, data := range dataSet {
-		net.backprop(data, deltaNablaWeights, deltaNablaBiases)
-		for i := range nablaWeights {
-			nablaWeights[i].AddWith(deltaNablaWeights[i])
-			nablaBiases[i].AddWith(deltaNablaBiases[i])
+
+	if *flKFold > 0 {
+		if cfg.BatchSize == 0 {
+			cfg.BatchSize = autoBatchSize(trainingset.Len() - trainingset.Len()/(*flKFold))
 		}
+		fmt.Printf("config: %s\n", cfg)
+		return crossValidate(ctx, trainingset, &cfg, loaderConfig, preprocess, *flKFold)
 	}
-	for i := range net.weights {
-		net.weights[i].SubWith(nablaWeights[i].ScaleWith(eta))
-		net.biases[i].SubWith(nablaBiases[i].ScaleWith(eta))
+
+	split := dataset.Split
+	if *flStratify {
+		split = dataset.StratifiedSplit
+	}
+	trainingdata, validationdata := split(trainingset, *flSplit, seed)
+	if trainingdata.Len() == 0 {
+		return errors.New("empty training set")
+	}
+
+	// corrupt training labels only, validation and test accuracy are measured
+	// on true labels
+	cleandata, flipped := trainingdata, []int(nil)
+	if noise != nil {
+		trainingdata, flipped = noise.Apply(cleandata, rand.New(rand.NewSource(seed)))
 	}
-}
 
-func (net *Network) backprop(data *dataset.Sample, nablaWeights, nablaBiases []*mathx.Matrix) {
-	n := len(net.weights)
-	for i := 0; i < n; i++ {
-		nablaWeights[i].Reset()
-		nablaBiases[i].Reset()
-	}
-	act := data.Input
-	acts := []*mathx.Matrix{act}
-	zs := make([]*mathx.Matrix, 0, n)
-	for i := 0; i < n; i++ {
-		z := net.weights[i].Mul(act).AddWith(net.biases[i])
-		zs = append(zs, z)
-		act = z.Map(net.actfuncs[i])
-		acts = append(acts, act)
-	}
-
-	delta := net.costDerivative(acts[n], data.Label).HadamardProduct(zs[n-1].Map(net.actderfuncs[n-1]).T())
-
-	nablaWeights[n-1] = delta.Mul(acts[n-1].T())
-	nablaBiases[n-1] = delta.Clone()
-	for i := n - 2; i >= 0; i-- {
-		z := zs[i]
-		sp := z.Map(net.actderfuncs[i])
-		delta = net.weights[i+1].T().Mul(delta).HadamardProduct(sp)
-		nablaWeights[i] = delta.Mul(acts[i].T())
-		nablaBiases[i] = delta.Clone()
+	// read test data
+	testdata, err := info.LoadTestSet(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = autoBatchSize(trainingdata.Len())
+	}
+	fmt.Printf("config: %s\n", cfg)
+
+	// train(and validate)
+	if checkpoint != nil {
+		// the network keeps its layers, loss and fitted preprocessing
+		fmt.Printf("resuming from epoch %d of %s\n", checkpoint.Epoch, *flResume)
+	} else {
+		net, err := cfg.newNetwork(trainingdata.ImageSize(), info.NumClasses)
+		if err != nil {
+			return err
+		}
+		if preprocess != nil {
+			preprocess.Fit(trainingdata)
+			net.SetPreprocess(preprocess)
+		}
+		checkpoint = &nn.Checkpoint{Network: net, Optimizer: optimizer, Scheduler: scheduler, Epochs: cfg.Epochs}
+	}
+	net := checkpoint.Network
+	opts := cfg.trainOptions(validationdata, checkpoint.Optimizer, checkpoint.Scheduler)
+	opts.InitialEpoch = checkpoint.Epoch
+	if *flCheckpoint != "" {
+		if err := cfg.WriteFile(configFile(*flCheckpoint)); err != nil {
+			return err
+		}
+		opts.Checkpoint = func(epoch int) error {
+			checkpoint.Epoch = epoch
+			return checkpoint.Save(*flCheckpoint)
+		}
+	}
+	// an interrupted training is still tested and saved
+	if err := net.Train(ctx, loaderConfig.newLoader(trainingdata, cfg.BatchSize, seed), opts); err != nil && !errors.Is(err, context.Canceled) {
+		return err
 	}
+
+	// test
+	accuracy, err := net.Evaluate(testdata)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("test accuracy = %.2f%%\n", accuracy*100)
+	if noise != nil {
+		if err := noiseReport(os.Stdout, net, cleandata, trainingdata, flipped); err != nil {
+			return err
+		}
+	}
+
+	if *flOutput != "" {
+		if err := net.Save(*flOutput); err != nil {
+			return err
+		}
+		if err := cfg.WriteFile(configFile(*flOutput)); err != nil {
+			return err
+		}
+	}
+
+	if *flQuantize != "" {
+		return quantizationReport(os.Stdout, net, nn.Quantize(net, granularity), testdata)
+	}
+	return nil
 }
 
-func (net *Network) costDerivative(act, output *mathx.Matrix) *mathx.Matrix {
-	return act.Sub(output).MapWith(cube)
+// loaderConfig configures loaders of training data
+type loaderConfig struct {
+	transform dataset.Transform
+	sampler   dataset.Sampler
+	// lossWeights are applied to each training set since balanced weights
+	// depend on class frequencies
+	lossWeights *dataset.LossWeights
 }
 
-func cube(x mathx.Float) mathx.Float {
-	return x * x * x
+// autoBatchSize returns the default mini-batch size of n training samples
+func autoBatchSize(n int) int {
+	if n < 6000 {
+		return 1
+	}
+	return n / 6000
 }
 
-func (net *Network) test(data *dataset.Sample) bool {
-	output := net.feedforward(data.Input)
-	i, _, _ := data.Label.MaxElem()
-	j, _, _ := output.MaxElem()
-	return i == j
+func (c loaderConfig) newLoader(trainingdata *dataset.Dataset, batchSize int, seed int64) *dataset.Loader {
+	loader := dataset.NewLoader(trainingdata, batchSize, seed)
+	loader.Transform = c.transform
+	loader.Sampler = c.sampler
+	loader.Weights = c.lossWeights.Of(trainingdata)
+	return loader
 }
 
-func (net *Network) evaluate(dataSet []*dataset.Sample) mathx.Float {
-	total := len(dataSet)
-	if total == 0 {
-		return 0
+// writeAugmentPreview writes the first n samples of set augmented by transform to dir
+func writeAugmentPreview(dir string, set *dataset.Dataset, transform dataset.Transform, n int, seed int64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
 	}
-	num := 0
-	for _, data := range dataSet {
-		if net.test(data) {
-			num++
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n && i < set.Len(); i++ {
+		img := set.ImageOf(i)
+		if transform != nil {
+			img = transform.Apply(img, rng)
+		}
+		filename := filepath.Join(dir, fmt.Sprintf("%05d_%d.png", i, set.Label(i)))
+		if err := dataset.WritePNG(filename, img.Gray()); err != nil {
+			return err
 		}
 	}
-	return mathx.Float(num) / mathx.Float(total)
+	return nil
 }
 
-func (net *Network) feedforward(input *mathx.Matrix) *mathx.Matrix {
-	n := len(net.weights)
-	for i := 0; i < n; i++ {
-		input = net.weights[i].Mul(input).AddWith(net.biases[i]).MapWith(net.actfuncs[i])
+// crossValidate trains a network for each fold and reports validation accuracy
+func crossValidate(ctx context.Context, trainingset *dataset.Dataset, cfg *Config, loaderConfig loaderConfig, preprocess *dataset.Pipeline, k int) error {
+	folds, err := dataset.KFold(trainingset, k, cfg.Seed)
+	if err != nil {
+		return usageError{err}
 	}
-	return input
-}
-
-func shuffle(dataSet []*dataset.Sample) {
-	for i := len(dataSet) - 1; i >= 0; i-- {
-		index := rand.Intn(i + 1)
-		dataSet[i], dataSet[index] = dataSet[index], dataSet[i]
+	var sum mathx.Float
+	n := 0
+	for folds.Next() {
+		trainingdata, validationdata := folds.Fold()
+		if validationdata.Len() == 0 {
+			continue
+		}
+		fmt.Printf("fold %d/%d: %d training samples, %d validation samples\n", folds.Index()+1, folds.Len(), trainingdata.Len(), validationdata.Len())
+		net, err := cfg.newNetwork(trainingdata.ImageSize(), trainingdata.NumClasses)
+		if err != nil {
+			return err
+		}
+		optimizer, err := cfg.newOptimizer()
+		if err != nil {
+			return err
+		}
+		scheduler, err := cfg.newScheduler()
+		if err != nil {
+			return err
+		}
+		if preprocess != nil {
+			// refit on each fold so that validation data never leaks into parameters
+			preprocess.Fit(trainingdata)
+			net.SetPreprocess(preprocess)
+		}
+		if err := net.Train(ctx, loaderConfig.newLoader(trainingdata, cfg.BatchSize, cfg.Seed), cfg.trainOptions(validationdata, optimizer, scheduler)); err != nil {
+			return err
+		}
+		accuracy, err := net.Evaluate(validationdata)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fold %d/%d: validation accuracy = %.2f%%\n", folds.Index()+1, folds.Len(), accuracy*100)
+		sum += accuracy
+		n++
 	}
+	fmt.Printf("%d-fold mean validation accuracy = %.2f%%\n", folds.Len(), sum/mathx.Float(n)*100)
+	return nil
 }
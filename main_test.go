@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/dataset/synth"
+	"github.com/mkideal/mnist/nn"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	dataset.Register(synth.Info)
+}
+
+// serveSynth serves a synthetic dataset and counts requests
+func serveSynth(t *testing.T, numTraining, numTest int) (*httptest.Server, *int32) {
+	dir := t.TempDir()
+	if err := synth.WriteMNIST(dir, numTraining, numTest, 1, synth.DefaultOptions); err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	fileServer := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRunSynthetic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("trains a network")
+	}
+	server, requests := serveSynth(t, 3000, 500)
+	cacheDir := t.TempDir()
+	model := filepath.Join(t.TempDir(), "model.gob")
+	err := run(context.Background(), []string{
+		"-dataset", synth.Info.Name,
+		"-d", server.URL,
+		"-cache", cacheDir,
+		"-seed", "1",
+		"-o", model,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(requests))
+	var cfg Config
+	if assert.NoError(t, cfg.ReadFile(configFile(model))) {
+		assert.Equal(t, int64(1), cfg.Seed)
+		assert.Equal(t, DefaultConfig.Layers, cfg.Layers)
+	}
+
+	// flags of run are not kept by the package defaults
+	assert.Equal(t, "", dataset.DefaultDownloader.CacheDir)
+	assert.True(t, dataset.DefaultBinaryCache.Disabled)
+
+	net, err := nn.Load(model)
+	if !assert.NoError(t, err) {
+		return
+	}
+	t.Setenv(dataset.CacheDirEnv, cacheDir)
+	testdata, err := synth.Info.LoadTestSet(context.Background(), server.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 500, testdata.Len())
+		accuracy, err := net.Evaluate(testdata)
+		assert.NoError(t, err)
+		assert.True(t, accuracy > 0.9, "accuracy %v", accuracy)
+	}
+
+	// cached files are used offline
+	err = run(context.Background(), []string{
+		"-dataset", synth.Info.Name,
+		"-d", server.URL,
+		"-cache", cacheDir,
+		"-offline",
+		"-kfold", "2",
+		"-augment-preview", t.TempDir(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(requests))
+}
+
+func TestRunResume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("trains a network")
+	}
+	server, _ := serveSynth(t, 600, 100)
+	dir := t.TempDir()
+	data := []string{"-dataset", synth.Info.Name, "-d", server.URL, "-cache", t.TempDir()}
+	train := func(args ...string) error {
+		return run(context.Background(), append(append([]string(nil), data...), args...))
+	}
+	straight, resumed, checkpoint := filepath.Join(dir, "straight.gob"), filepath.Join(dir, "resumed.gob"), filepath.Join(dir, "checkpoint.gob")
+	assert.NoError(t, train("-seed", "1", "-optimizer", "adam", "-epochs", "3", "-o", straight))
+	assert.NoError(t, train("-seed", "1", "-optimizer", "adam", "-epochs", "2", "-checkpoint", checkpoint))
+	c, err := nn.LoadCheckpoint(checkpoint)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, c.Epoch)
+		assert.Equal(t, "adam", c.Optimizer.String())
+	}
+	// the seed and optimizer are read from the config saved with the checkpoint
+	assert.NoError(t, train("-epochs", "3", "-resume", checkpoint, "-o", resumed))
+
+	want, err := os.ReadFile(straight)
+	if assert.NoError(t, err) {
+		got, err := os.ReadFile(resumed)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(want, got), "resumed model differs from uninterrupted one")
+	}
+
+	err = train("-optimizer", "sgd", "-resume", checkpoint)
+	assert.ErrorAs(t, err, new(usageError))
+	err = train("-lr-schedule", "cosine", "-resume", checkpoint)
+	assert.NoError(t, err, "a constant learning rate can be scheduled on resume")
+
+	// schedules depend on the number of epochs
+	scheduled := filepath.Join(dir, "scheduled.gob")
+	assert.NoError(t, train("-seed", "1", "-lr-schedule", "cosine", "-epochs", "1", "-checkpoint", scheduled))
+	err = train("-epochs", "3", "-resume", scheduled)
+	assert.ErrorAs(t, err, new(usageError))
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"-bogus"},
+		{"-q", "x"},
+		{"-dataset", "unknown"},
+		{"-augment", "unknown"},
+		{"-sampler", "unknown"},
+		{"-preprocess", "unknown"},
+		{"-loss", "unknown"},
+		{"-label-noise", "uniform=2"},
+		{"-config", "missing.yaml"},
+		{"-epochs", "0"},
+		{"-layers", "x"},
+		{"-optimizer", "unknown"},
+		{"-lr-schedule", "step=0"},
+		{"-sampler", "class=0,0,0,0,0,0,0,0,0,0"},
+		{"-class-weights", "1,2"},
+		{"-kfold", "2", "-checkpoint", "checkpoint.gob"},
+		{"-kfold", "1"},
+		{"-split", "1", "-lr-schedule", "warmup=1+plateau"},
+	} {
+		err := run(context.Background(), args)
+		assert.ErrorAs(t, err, new(usageError), "%v", args)
+	}
+}
+
+func TestPredictUsage(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"-images", dir},
+		{"-m", "model.gob"},
+		{"-m", "model.gob", "-images", dir, "-labels", "labels.gz"},
+		{"-m", "model.gob", "-images", dir, "-dataset", "unknown"},
+		{"-m", "model.gob", "-images", dir, "-invert", "unknown"},
+	} {
+		err := predictCommand(args)
+		assert.ErrorAs(t, err, new(usageError), "%v", args)
+	}
+}
+
+func TestInspectUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"-dataset", "unknown"},
+		{"-dataset", dataset.EMNISTLetters.Name},
+	} {
+		err := inspectCommand(args)
+		assert.ErrorAs(t, err, new(usageError), "%v", args)
+	}
+
+	// nothing is downloaded offline
+	err := inspectCommand([]string{"-cache", t.TempDir(), "-offline"})
+	assert.ErrorIs(t, err, dataset.ErrOffline)
+	assert.False(t, dataset.DefaultDownloader.Offline)
+}
+
+func TestConvertUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"-csv", "train.csv", "csv2idx"},
+		{"-csv", "train.csv", "-images", "images.gz"},
+		{"-csv", "train.csv", "-images", "images.gz", "unknown"},
+		{"-csv", "train.csv", "-images", "images.gz", "-dataset", "unknown", "csv2idx"},
+	} {
+		err := convertCommand(args)
+		assert.ErrorAs(t, err, new(usageError), "%v", args)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "letters.csv")
+	var buf bytes.Buffer
+	w := dataset.NewCSVWriter(&buf, 28*28, true)
+	pixels := make([]uint8, 28*28)
+	for i := range pixels {
+		pixels[i] = uint8(i)
+	}
+	assert.NoError(t, w.WritePixels(pixels, 0))
+	assert.NoError(t, w.WritePixels(pixels, 25))
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, os.WriteFile(csvFile, buf.Bytes(), 0644))
+
+	// EMNIST images are stored transposed with labels starting from 1
+	images, labels := filepath.Join(dir, "images.gz"), filepath.Join(dir, "labels.gz")
+	assert.NoError(t, convertCommand([]string{"-dataset", "emnist-letters", "-csv", csvFile, "-images", images, "-labels", labels, "csv2idx"}))
+	roundTrip := filepath.Join(dir, "roundtrip.csv")
+	assert.NoError(t, convertCommand([]string{"-dataset", "emnist-letters", "-csv", roundTrip, "-images", images, "-labels", labels, "idx2csv"}))
+	data, err := os.ReadFile(roundTrip)
+	if assert.NoError(t, err) {
+		assert.Equal(t, buf.String(), string(data))
+	}
+}
@@ -0,0 +1,34 @@
+package mathx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymmetricEigen(t *testing.T) {
+	a := NewMatrix(3, 3)
+	for i, x := range []Float{4, 1, 2, 1, 3, 0, 2, 0, 5} {
+		a.data[i] = x
+	}
+	values, vectors := SymmetricEigen(a)
+	assert.Equal(t, 3, len(values))
+	for i := 1; i < len(values); i++ {
+		assert.True(t, values[i-1] <= values[i])
+	}
+	for i, value := range values {
+		v := vectors.Col(i)
+		assert.InDelta(t, 1, float64(v.L2()), 1e-9)
+		assert.True(t, a.Mul(v).Equal(v.Scale(value)), "eigenpair %d", i)
+	}
+	assert.InDelta(t, 12, float64(values[0]+values[1]+values[2]), 1e-9)
+
+	// random symmetric matrix
+	b := NewMatrix(20, 20).RandInit(-1, 1)
+	b = b.Add(b.T())
+	values, vectors = SymmetricEigen(b)
+	for i, value := range values {
+		v := vectors.Col(i)
+		assert.True(t, b.Mul(v).Equal(v.Scale(value)), "eigenpair %d", i)
+	}
+}
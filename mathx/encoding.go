@@ -0,0 +1,40 @@
+package mathx
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errMatrixData = errors.New("mathx: invalid matrix data")
+
+// MarshalBinary encodes the matrix as row count, column count, transpose flag and elements
+func (mat *Matrix) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 17+8*len(mat.data))
+	binary.BigEndian.PutUint64(buf[0:], uint64(mat.m))
+	binary.BigEndian.PutUint64(buf[8:], uint64(mat.n))
+	if mat.transpose {
+		buf[16] = 1
+	}
+	for i, x := range mat.data {
+		binary.BigEndian.PutUint64(buf[17+8*i:], math.Float64bits(float64(x)))
+	}
+	return buf, nil
+}
+
+func (mat *Matrix) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 17 {
+		return errMatrixData
+	}
+	m, n := binary.BigEndian.Uint64(buf[0:]), binary.BigEndian.Uint64(buf[8:])
+	if m > math.MaxInt32 || n > math.MaxInt32 || (len(buf)-17)%8 != 0 || uint64(len(buf)-17)/8 != m*n {
+		return errMatrixData
+	}
+	mat.m, mat.n = int(m), int(n)
+	mat.transpose = buf[16] != 0
+	mat.data = make([]Float, m*n)
+	for i := range mat.data {
+		mat.data[i] = Float(math.Float64frombits(binary.BigEndian.Uint64(buf[17+8*i:])))
+	}
+	return nil
+}
@@ -134,6 +134,16 @@ func (mat *Matrix) Set(i, j int, x Float) *Matrix {
 	return mat
 }
 
+// Col returns a copy of the j-th column as a column vector
+func (mat *Matrix) Col(j int) *Matrix {
+	m := mat.RowCount()
+	col := NewMatrix(m, 1)
+	for i := 0; i < m; i++ {
+		col.data[i] = mat.Get(i, j)
+	}
+	return col
+}
+
 func (mat *Matrix) T() *Matrix {
 	mat2 := mat.Clone()
 	mat2.transpose = !mat2.transpose
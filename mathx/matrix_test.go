@@ -83,3 +83,13 @@ func TestMatrixMap(t *testing.T) {
 	mat = mat.Map(func(x Float) Float { return 1 })
 	assert.True(t, NewMatrixOne(2, 3).Equal(mat))
 }
+
+func TestMatrixMarshalBinary(t *testing.T) {
+	mat := NewMatrix(2, 3).RandInit(-1, 1).SelfT()
+	data, err := mat.MarshalBinary()
+	assert.NoError(t, err)
+	mat2 := new(Matrix)
+	assert.NoError(t, mat2.UnmarshalBinary(data))
+	assert.Equal(t, mat, mat2)
+	assert.Error(t, mat2.UnmarshalBinary(data[:len(data)-1]))
+}
@@ -0,0 +1,150 @@
+package mathx
+
+import (
+	"fmt"
+	"math"
+)
+
+// QuantGranularity specifies how many scale/zero-point pairs a quantized matrix uses
+type QuantGranularity int
+
+const (
+	PerTensor QuantGranularity = iota // one scale and zero point for the whole matrix
+	PerRow                            // one scale and zero point for each row
+)
+
+const (
+	qmin = math.MinInt8
+	qmax = math.MaxInt8
+)
+
+// QuantizedMatrix is an int8 matrix with affine quantization:
+//
+//	real = scale * (q - zeroPoint)
+type QuantizedMatrix struct {
+	m, n        int
+	granularity QuantGranularity
+	data        []int8
+	scales      []Float
+	zeroPoints  []int32
+}
+
+// Quantize quantizes mat to int8 with given granularity
+func Quantize(mat *Matrix, granularity QuantGranularity) *QuantizedMatrix {
+	m, n := mat.RowCount(), mat.ColCount()
+	q := &QuantizedMatrix{
+		m:           m,
+		n:           n,
+		granularity: granularity,
+		data:        make([]int8, m*n),
+	}
+	groups, groupSize := 1, m*n
+	if granularity == PerRow {
+		groups, groupSize = m, n
+	}
+	q.scales = make([]Float, groups)
+	q.zeroPoints = make([]int32, groups)
+	for g := 0; g < groups; g++ {
+		var min, max Float
+		for k := g * groupSize; k < (g+1)*groupSize; k++ {
+			x := mat.Get(k/n, k%n)
+			if x < min {
+				min = x
+			}
+			if x > max {
+				max = x
+			}
+		}
+		scale, zp := quantParams(min, max)
+		q.scales[g], q.zeroPoints[g] = scale, zp
+		for k := g * groupSize; k < (g+1)*groupSize; k++ {
+			q.data[k] = quantizeValue(mat.Get(k/n, k%n), scale, zp)
+		}
+	}
+	return q
+}
+
+// quantParams computes scale and zero point which map [min, max] to [qmin, qmax],
+// the range is extended to include 0 so that 0 is exactly representable.
+func quantParams(min, max Float) (scale Float, zeroPoint int32) {
+	if max == min {
+		return 1, 0
+	}
+	scale = (max - min) / (qmax - qmin)
+	zp := math.Round(float64(qmin - min/scale))
+	if zp < qmin {
+		zp = qmin
+	} else if zp > qmax {
+		zp = qmax
+	}
+	return scale, int32(zp)
+}
+
+func quantizeValue(x, scale Float, zeroPoint int32) int8 {
+	v := math.Round(float64(x/scale)) + float64(zeroPoint)
+	if v < qmin {
+		v = qmin
+	} else if v > qmax {
+		v = qmax
+	}
+	return int8(v)
+}
+
+func (q *QuantizedMatrix) RowCount() int { return q.m }
+func (q *QuantizedMatrix) ColCount() int { return q.n }
+
+// Size returns number of bytes used by quantized values and parameters
+func (q *QuantizedMatrix) Size() int { return len(q.data) + len(q.scales)*(8+4) }
+
+func (q *QuantizedMatrix) group(i int) int {
+	if q.granularity == PerRow {
+		return i
+	}
+	return 0
+}
+
+// Scale returns the scale of row i
+func (q *QuantizedMatrix) Scale(i int) Float { return q.scales[q.group(i)] }
+
+// ZeroPoint returns the zero point of row i
+func (q *QuantizedMatrix) ZeroPoint(i int) int32 { return q.zeroPoints[q.group(i)] }
+
+func (q *QuantizedMatrix) Get(i, j int) int8 { return q.data[i*q.n+j] }
+
+// Dequantize converts q back to a float matrix
+func (q *QuantizedMatrix) Dequantize() *Matrix {
+	mat := NewMatrix(q.m, q.n)
+	for i := 0; i < q.m; i++ {
+		scale, zp := q.Scale(i), q.ZeroPoint(i)
+		for j := 0; j < q.n; j++ {
+			mat.data[i*q.n+j] = scale * Float(int32(q.data[i*q.n+j])-zp)
+		}
+	}
+	return mat
+}
+
+// MulDequantize multiplies q by right using int32 accumulation and returns
+// the dequantized product. right must be quantized per tensor.
+func (q *QuantizedMatrix) MulDequantize(right *QuantizedMatrix) *Matrix {
+	m, n, l := q.m, right.n, q.n
+	if l != right.m {
+		panic(fmt.Sprintf("QuantizedMatrix.MulDequantize: dim mismatch: %dx%d vs %dx%d", m, l, right.m, n))
+	}
+	if right.granularity != PerTensor {
+		panic("QuantizedMatrix.MulDequantize: right operand must be quantized per tensor")
+	}
+	rscale, rzp := right.scales[0], right.zeroPoints[0]
+	ans := NewMatrix(m, n)
+	for i := 0; i < m; i++ {
+		scale, zp := q.Scale(i), q.ZeroPoint(i)
+		row := q.data[i*l : (i+1)*l]
+		for j := 0; j < n; j++ {
+			var acc int32
+			for k, x := range row {
+				acc += (int32(x) - zp) * (int32(right.data[k*n+j]) - rzp)
+			}
+			ans.data[i*n+j] = scale * rscale * Float(acc)
+		}
+	}
+	return ans
+}
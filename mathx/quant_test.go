@@ -0,0 +1,42 @@
+package mathx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantize(t *testing.T) {
+	mat := NewMatrix(2, 3)
+	mat.Set(0, 0, -1).Set(0, 1, 0.5).Set(0, 2, 1)
+	mat.Set(1, 0, 0).Set(1, 1, 0.01).Set(1, 2, 0.02)
+
+	for _, g := range []QuantGranularity{PerTensor, PerRow} {
+		q := Quantize(mat, g)
+		assert.Equal(t, 2, q.RowCount())
+		assert.Equal(t, 3, q.ColCount())
+		deq := q.Dequantize()
+		for i := 0; i < 2; i++ {
+			for j := 0; j < 3; j++ {
+				assert.InDelta(t, float64(mat.Get(i, j)), float64(deq.Get(i, j)), float64(q.Scale(i)))
+			}
+		}
+	}
+	// per row quantization keeps small rows precise
+	assert.Less(t, float64(Quantize(mat, PerRow).Scale(1)), float64(Quantize(mat, PerTensor).Scale(1)))
+
+	zero := Quantize(NewMatrix(2, 2), PerTensor)
+	assert.True(t, NewMatrix(2, 2).Equal(zero.Dequantize()))
+}
+
+func TestQuantizedMulDequantize(t *testing.T) {
+	w := NewMatrix(3, 4).RandInit(-1, 1)
+	x := NewMatrix(4, 1).RandInit(0, 1)
+	want := w.Mul(x)
+	got := Quantize(w, PerRow).MulDequantize(Quantize(x, PerTensor))
+	assert.Equal(t, want.RowCount(), got.RowCount())
+	for i := 0; i < want.RowCount(); i++ {
+		assert.InDelta(t, float64(want.Get(i, 0)), float64(got.Get(i, 0)), 0.05)
+	}
+	assert.Panics(t, func() { Quantize(w, PerRow).MulDequantize(Quantize(w, PerTensor)) })
+}
@@ -0,0 +1,77 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Activation is the activation function of a hidden layer
+type Activation struct {
+	Name string
+	f    mathx.UnaryFunction
+	// df is the derivative of f
+	df mathx.UnaryFunction
+}
+
+func (a Activation) String() string { return a.Name }
+
+var (
+	Sigmoid = Activation{Name: "sigmoid", f: mathx.Sigmoid, df: mathx.SigmoidPrime}
+	Tanh    = Activation{Name: "tanh", f: tanh, df: tanhPrime}
+	ReLU    = Activation{Name: "relu", f: relu, df: reluPrime}
+	// LeakyReLU has slope 0.01 for negative inputs
+	LeakyReLU = Activation{Name: "leaky-relu", f: leakyReLU, df: leakyReLUPrime}
+)
+
+var activations = []Activation{Sigmoid, Tanh, ReLU, LeakyReLU}
+
+// ParseActivation returns the activation of name: sigmoid, tanh, relu or
+// leaky-relu, Sigmoid returned if name is empty
+func ParseActivation(name string) (Activation, error) {
+	if name == "" {
+		return Sigmoid, nil
+	}
+	for _, a := range activations {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return Activation{}, fmt.Errorf("unknown activation %q", name)
+}
+
+func tanh(x mathx.Float) mathx.Float { return mathx.Float(math.Tanh(float64(x))) }
+
+func tanhPrime(x mathx.Float) mathx.Float {
+	t := tanh(x)
+	return 1 - t*t
+}
+
+func relu(x mathx.Float) mathx.Float {
+	if x > 0 {
+		return x
+	}
+	return 0
+}
+
+func reluPrime(x mathx.Float) mathx.Float {
+	if x > 0 {
+		return 1
+	}
+	return 0
+}
+
+func leakyReLU(x mathx.Float) mathx.Float {
+	if x > 0 {
+		return x
+	}
+	return 0.01 * x
+}
+
+func leakyReLUPrime(x mathx.Float) mathx.Float {
+	if x > 0 {
+		return 1
+	}
+	return 0.01
+}
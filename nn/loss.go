@@ -0,0 +1,368 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+// Loss is the training objective of a network. A loss decides the activation
+// of the output layer, so that gradients of pairs like softmax and
+// cross-entropy are computed directly and stably.
+type Loss interface {
+	// Output returns the network output of weighted input z of the output layer
+	Output(z *mathx.Matrix) *mathx.Matrix
+	// Value returns the loss of weighted input z for one-hot label y
+	Value(z, y *mathx.Matrix) mathx.Float
+	// Gradient returns the derivative of the loss with respect to z
+	Gradient(z, y *mathx.Matrix) *mathx.Matrix
+	// String returns the spec of the loss accepted by ParseLoss
+	String() string
+}
+
+// epsilon keeps logarithms of probabilities finite
+const epsilon = 1e-12
+
+func logClamped(x mathx.Float) mathx.Float {
+	if x < epsilon {
+		x = epsilon
+	}
+	return mathx.Float(math.Log(float64(x)))
+}
+
+// softmax returns exp(z) normalized to sum 1, shifted by max(z) to avoid overflow
+func softmax(z *mathx.Matrix) *mathx.Matrix {
+	_, _, max := z.MaxElem()
+	p := z.Map(func(x mathx.Float) mathx.Float { return mathx.Float(math.Exp(float64(x - max))) })
+	return p.ScaleWith(1 / p.Accumulate(mathx.Identity))
+}
+
+// crossEntropy returns -sum(q*log(p)) of target distribution q
+func crossEntropy(p, q *mathx.Matrix) mathx.Float {
+	var sum mathx.Float
+	for i := 0; i < p.RowCount(); i++ {
+		if t := q.Get(i, 0); t != 0 {
+			sum -= t * logClamped(p.Get(i, 0))
+		}
+	}
+	return sum
+}
+
+// CubicLoss is sum((a-y)^4)/4 of sigmoid outputs a, its gradient grows with
+// the cube of the error
+type CubicLoss struct{}
+
+func (CubicLoss) Output(z *mathx.Matrix) *mathx.Matrix { return z.Map(mathx.Sigmoid) }
+
+func (l CubicLoss) Value(z, y *mathx.Matrix) mathx.Float {
+	d := l.Output(z).SubWith(y)
+	return d.Accumulate(func(x mathx.Float) mathx.Float { return x * x * x * x / 4 })
+}
+
+func (l CubicLoss) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	return l.Output(z).SubWith(y).MapWith(cube).HadamardProductWith(z.Map(mathx.SigmoidPrime))
+}
+
+func (CubicLoss) String() string { return "cubic" }
+
+func cube(x mathx.Float) mathx.Float {
+	return x * x * x
+}
+
+// MSE is the quadratic loss sum((a-y)^2)/2 of sigmoid outputs a
+type MSE struct{}
+
+func (MSE) Output(z *mathx.Matrix) *mathx.Matrix { return z.Map(mathx.Sigmoid) }
+
+func (l MSE) Value(z, y *mathx.Matrix) mathx.Float {
+	d := l.Output(z).SubWith(y)
+	return d.Accumulate(func(x mathx.Float) mathx.Float { return x * x / 2 })
+}
+
+func (l MSE) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	return l.Output(z).SubWith(y).HadamardProductWith(z.Map(mathx.SigmoidPrime))
+}
+
+func (MSE) String() string { return "mse" }
+
+// BinaryCrossEntropy is -sum(y*log(a) + (1-y)*log(1-a)) of sigmoid outputs a,
+// each output is an independent probability of its class. It's computed from
+// z directly, so it's stable for saturated outputs and its gradient is a-y.
+type BinaryCrossEntropy struct{}
+
+func (BinaryCrossEntropy) Output(z *mathx.Matrix) *mathx.Matrix { return z.Map(mathx.Sigmoid) }
+
+func (BinaryCrossEntropy) Value(z, y *mathx.Matrix) mathx.Float {
+	var sum mathx.Float
+	for i := 0; i < z.RowCount(); i++ {
+		// -log(sigmoid(z)) = softplus(-z), -log(1-sigmoid(z)) = softplus(z)
+		x, t := z.Get(i, 0), y.Get(i, 0)
+		sum += softplus(x) - t*x
+	}
+	return sum
+}
+
+func (l BinaryCrossEntropy) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	return l.Output(z).SubWith(y)
+}
+
+func (BinaryCrossEntropy) String() string { return "bce" }
+
+// softplus returns log(1+exp(x)) without overflow
+func softplus(x mathx.Float) mathx.Float {
+	if x > 0 {
+		return x + mathx.Float(math.Log1p(math.Exp(-float64(x))))
+	}
+	return mathx.Float(math.Log1p(math.Exp(float64(x))))
+}
+
+// Hinge is the multi-class hinge loss sum(max(0, 1+z[j]-z[label])) over
+// classes j other than the label (Weston and Watkins, 1999), it's zero once
+// the label scores a margin of 1 above every other class. Outputs are softmax
+// of scores, so that they can be read as probabilities.
+type Hinge struct{}
+
+func (Hinge) Output(z *mathx.Matrix) *mathx.Matrix { return softmax(z) }
+
+func (Hinge) Value(z, y *mathx.Matrix) mathx.Float {
+	label, _, _ := y.MaxElem()
+	var sum mathx.Float
+	for j := 0; j < z.RowCount(); j++ {
+		if margin := 1 + z.Get(j, 0) - z.Get(label, 0); j != label && margin > 0 {
+			sum += margin
+		}
+	}
+	return sum
+}
+
+func (Hinge) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	label, _, _ := y.MaxElem()
+	grad := mathx.NewMatrix(z.RowCount(), 1)
+	for j := 0; j < z.RowCount(); j++ {
+		if margin := 1 + z.Get(j, 0) - z.Get(label, 0); j != label && margin > 0 {
+			grad.Set(j, 0, 1)
+			grad.Set(label, 0, grad.Get(label, 0)-1)
+		}
+	}
+	return grad
+}
+
+func (Hinge) String() string { return "hinge" }
+
+// CrossEntropy is the categorical cross-entropy of softmax outputs, the
+// gradient of the fused pair is p-y. Label smoothing mixes one-hot labels with
+// the uniform distribution, (1-Smoothing)*y + Smoothing/k, which keeps the
+// network from becoming overconfident in noisy labels.
+type CrossEntropy struct {
+	Smoothing mathx.Float
+}
+
+func (CrossEntropy) Output(z *mathx.Matrix) *mathx.Matrix { return softmax(z) }
+
+func (l CrossEntropy) target(y *mathx.Matrix) *mathx.Matrix {
+	if l.Smoothing == 0 {
+		return y
+	}
+	k := mathx.Float(y.RowCount())
+	return y.Map(func(x mathx.Float) mathx.Float { return (1-l.Smoothing)*x + l.Smoothing/k })
+}
+
+func (l CrossEntropy) Value(z, y *mathx.Matrix) mathx.Float {
+	return crossEntropy(softmax(z), l.target(y))
+}
+
+func (l CrossEntropy) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	return softmax(z).SubWith(l.target(y))
+}
+
+func (l CrossEntropy) String() string {
+	if l.Smoothing == 0 {
+		return "ce"
+	}
+	return "smooth=" + formatFloat(l.Smoothing)
+}
+
+// SymmetricCrossEntropy is Alpha*CE + Beta*RCE of softmax outputs p, where the
+// reverse cross-entropy RCE = -sum(p*log(y)) takes log(0) as A, i.e.
+// -A*(1-p[label]). RCE is bounded and tolerant to noisy labels while CE
+// keeps fitting clean ones (Wang et al., 2019).
+type SymmetricCrossEntropy struct {
+	Alpha, Beta, A mathx.Float
+}
+
+// DefaultSymmetricCrossEntropy is the symmetric cross-entropy of spec "sce"
+var DefaultSymmetricCrossEntropy = SymmetricCrossEntropy{Alpha: 0.1, Beta: 1, A: -4}
+
+func (SymmetricCrossEntropy) Output(z *mathx.Matrix) *mathx.Matrix { return softmax(z) }
+
+func (l SymmetricCrossEntropy) Value(z, y *mathx.Matrix) mathx.Float {
+	p := softmax(z)
+	label, _, _ := y.MaxElem()
+	return l.Alpha*crossEntropy(p, y) - l.Beta*l.A*(1-p.Get(label, 0))
+}
+
+func (l SymmetricCrossEntropy) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	p := softmax(z)
+	label, _, _ := y.MaxElem()
+	// d(1-p[label])/dz = p[label]*(p-y)
+	scale := l.Alpha - l.Beta*l.A*p.Get(label, 0)
+	return p.SubWith(y).ScaleWith(scale)
+}
+
+func (l SymmetricCrossEntropy) String() string {
+	return "sce=" + formatFloat(l.Alpha) + "," + formatFloat(l.Beta) + "," + formatFloat(l.A)
+}
+
+// Bootstrapping is the cross-entropy of softmax outputs p against the target
+// Beta*y + (1-Beta)*q, which trusts the network's own prediction q as much as
+// 1-Beta (Reed et al., 2014). The soft version takes q = p, which adds a
+// minimum entropy term, the hard version takes q = onehot(argmax p).
+type Bootstrapping struct {
+	Beta mathx.Float
+	Hard bool
+}
+
+func (Bootstrapping) Output(z *mathx.Matrix) *mathx.Matrix { return softmax(z) }
+
+func (l Bootstrapping) Value(z, y *mathx.Matrix) mathx.Float {
+	p := softmax(z)
+	if l.Hard {
+		return crossEntropy(p, l.hardTarget(p, y))
+	}
+	return l.Beta*crossEntropy(p, y) + (1-l.Beta)*crossEntropy(p, p)
+}
+
+func (l Bootstrapping) hardTarget(p, y *mathx.Matrix) *mathx.Matrix {
+	q := y.Scale(l.Beta)
+	i, _, _ := p.MaxElem()
+	return q.Set(i, 0, q.Get(i, 0)+1-l.Beta)
+}
+
+func (l Bootstrapping) Gradient(z, y *mathx.Matrix) *mathx.Matrix {
+	p := softmax(z)
+	if l.Hard {
+		// the prediction is a constant target
+		return p.Sub(l.hardTarget(p, y))
+	}
+	// entropy H = -sum(p*log(p)), dH/dz = -p*(log(p)+H)
+	h := crossEntropy(p, p)
+	grad := p.Sub(y).ScaleWith(l.Beta)
+	for i := 0; i < p.RowCount(); i++ {
+		pi := p.Get(i, 0)
+		grad.Set(i, 0, grad.Get(i, 0)-(1-l.Beta)*pi*(logClamped(pi)+h))
+	}
+	return grad
+}
+
+func (l Bootstrapping) String() string {
+	name := "bootstrap"
+	if l.Hard {
+		name = "bootstrap-hard"
+	}
+	return name + "=" + formatFloat(l.Beta)
+}
+
+// DefaultLearningRate returns the learning rate used with loss and SGD if
+// TrainOptions.LearningRate is 0, gradients of losses of sigmoid outputs are
+// damped by the sigmoid derivative and gradients of the hinge loss are never
+// smaller than 1
+func DefaultLearningRate(loss Loss) mathx.Float {
+	switch loss.(type) {
+	case CubicLoss, MSE:
+		return 4
+	case Hinge:
+		return 0.1
+	}
+	return 0.5
+}
+
+// DefaultOptimizerLearningRate returns the learning rate used with loss and
+// optimizer if TrainOptions.LearningRate is 0, nil optimizer is SGD. Steps of
+// adaptive optimizers don't depend on the scale of gradients, momentum mu
+// amplifies steps of SGD by 1/(1-mu).
+func DefaultOptimizerLearningRate(loss Loss, optimizer Optimizer) mathx.Float {
+	switch o := optimizer.(type) {
+	case *SGD:
+		return DefaultLearningRate(loss) * (1 - o.Momentum)
+	case *Adagrad:
+		return 0.01
+	case *RMSProp, *Adam:
+		return 0.001
+	}
+	return DefaultLearningRate(loss)
+}
+
+func formatFloat(x mathx.Float) string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 64)
+}
+
+// ParseLoss parses a loss spec: cubic, mse, bce, ce, hinge, smooth[=eps],
+// sce[=alpha,beta[,A]], bootstrap[=beta] or bootstrap-hard[=beta], CubicLoss
+// returned if spec is empty
+func ParseLoss(spec string) (Loss, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), "=")
+	var args []mathx.Float
+	if hasArg {
+		for _, field := range strings.Split(arg, ",") {
+			x, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid loss parameter %q", field)
+			}
+			args = append(args, mathx.Float(x))
+		}
+	}
+	param := func(i int, def mathx.Float) mathx.Float {
+		if i < len(args) {
+			return args[i]
+		}
+		return def
+	}
+	probability := func(x mathx.Float) error {
+		if x < 0 || x > 1 {
+			return fmt.Errorf("loss parameter %v of %q out of range [0, 1]", x, spec)
+		}
+		return nil
+	}
+	var loss Loss
+	maxArgs := 1
+	switch name {
+	case "", "cubic":
+		loss, maxArgs = CubicLoss{}, 0
+	case "mse":
+		loss, maxArgs = MSE{}, 0
+	case "bce":
+		loss, maxArgs = BinaryCrossEntropy{}, 0
+	case "ce":
+		loss, maxArgs = CrossEntropy{}, 0
+	case "hinge":
+		loss, maxArgs = Hinge{}, 0
+	case "smooth":
+		l := CrossEntropy{Smoothing: param(0, 0.1)}
+		if err := probability(l.Smoothing); err != nil {
+			return nil, err
+		}
+		loss = l
+	case "sce":
+		d := DefaultSymmetricCrossEntropy
+		loss, maxArgs = SymmetricCrossEntropy{Alpha: param(0, d.Alpha), Beta: param(1, d.Beta), A: param(2, d.A)}, 3
+	case "bootstrap", "bootstrap-hard":
+		l := Bootstrapping{Hard: name == "bootstrap-hard", Beta: 0.95}
+		if l.Hard {
+			l.Beta = 0.8
+		}
+		l.Beta = param(0, l.Beta)
+		if err := probability(l.Beta); err != nil {
+			return nil, err
+		}
+		loss = l
+	default:
+		return nil, fmt.Errorf("unknown loss %q", spec)
+	}
+	if len(args) > maxArgs {
+		return nil, fmt.Errorf("too many parameters of loss %q", spec)
+	}
+	return loss, nil
+}
@@ -0,0 +1,84 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLossGradient(t *testing.T) {
+	z := mathx.NewMatrixWithColVector([]mathx.Float{0.5, -1, 2, 0.1})
+	y := mathx.NewMatrixWithColVector([]mathx.Float{0, 1, 0, 0})
+	for _, loss := range []Loss{
+		CubicLoss{},
+		MSE{},
+		BinaryCrossEntropy{},
+		Hinge{},
+		CrossEntropy{},
+		CrossEntropy{Smoothing: 0.1},
+		DefaultSymmetricCrossEntropy,
+		Bootstrapping{Beta: 0.95},
+		Bootstrapping{Beta: 0.8, Hard: true},
+	} {
+		grad := loss.Gradient(z, y)
+		const h = 1e-6
+		for i := 0; i < z.RowCount(); i++ {
+			x := z.Get(i, 0)
+			z.Set(i, 0, x+h)
+			plus := loss.Value(z, y)
+			z.Set(i, 0, x-h)
+			minus := loss.Value(z, y)
+			z.Set(i, 0, x)
+			assert.InDelta(t, float64((plus-minus)/(2*h)), float64(grad.Get(i, 0)), 1e-6, "%v: dz[%d]", loss, i)
+		}
+		assert.True(t, loss.Value(z, y) > 0, "%v", loss)
+	}
+}
+
+func TestParseLoss(t *testing.T) {
+	for spec, want := range map[string]Loss{
+		"":                   CubicLoss{},
+		"cubic":              CubicLoss{},
+		"mse":                MSE{},
+		"bce":                BinaryCrossEntropy{},
+		"hinge":              Hinge{},
+		"ce":                 CrossEntropy{},
+		"smooth":             CrossEntropy{Smoothing: 0.1},
+		"smooth=0.2":         CrossEntropy{Smoothing: 0.2},
+		"sce":                DefaultSymmetricCrossEntropy,
+		"sce=1,0.5":          SymmetricCrossEntropy{Alpha: 1, Beta: 0.5, A: -4},
+		"bootstrap":          Bootstrapping{Beta: 0.95},
+		"bootstrap-hard=0.7": Bootstrapping{Beta: 0.7, Hard: true},
+	} {
+		loss, err := ParseLoss(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, want, loss, spec)
+			// the spec round trips through saved models
+			again, err := ParseLoss(loss.String())
+			assert.NoError(t, err)
+			assert.Equal(t, loss, again)
+		}
+	}
+	for _, spec := range []string{"mse?", "hinge=1", "ce=1", "smooth=2", "bootstrap=x", "sce=1,2,3,4"} {
+		_, err := ParseLoss(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLossValues(t *testing.T) {
+	z := mathx.NewMatrixWithColVector([]mathx.Float{3, 0, -1})
+	y := mathx.NewMatrixWithColVector([]mathx.Float{1, 0, 0})
+	// margins 1+0-3 and 1-1-3 are negative, for label 1 margins are 1+3-0 and 1-1-0
+	assert.Equal(t, mathx.Float(0), Hinge{}.Value(z, y))
+	assert.Equal(t, mathx.Float(4), Hinge{}.Value(z, mathx.NewMatrixWithColVector([]mathx.Float{0, 1, 0})))
+
+	// saturated outputs don't overflow
+	big := mathx.NewMatrixWithColVector([]mathx.Float{1000, -1000, 0})
+	for _, loss := range []Loss{BinaryCrossEntropy{}, CrossEntropy{}, MSE{}} {
+		v := loss.Value(big, y)
+		assert.False(t, math.IsNaN(float64(v)) || math.IsInf(float64(v), 0), "%v: %v", loss, v)
+	}
+	assert.InDelta(t, math.Log(2), float64(BinaryCrossEntropy{}.Value(big, y)), 1e-9)
+}
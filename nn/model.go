@@ -0,0 +1,270 @@
+package nn
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+)
+
+const modelVersion = 1
+
+// model is the serialized form of a Network
+type model struct {
+	Version    int
+	Sizes      []int
+	Weights    []*mathx.Matrix
+	Biases     []*mathx.Matrix
+	Preprocess *dataset.Pipeline
+	// Loss is the spec of the loss, empty in models saved before losses were
+	// configurable which were trained with CubicLoss
+	Loss string
+	// Activations are names of activations of hidden layers, empty in models
+	// saved before activations were configurable which used Sigmoid
+	Activations []string
+	// Optimizer, Scheduler, Epoch and Epochs are saved by checkpoints only
+	Optimizer Optimizer
+	Scheduler Scheduler
+	Epoch     int
+	Epochs    int
+}
+
+// Encode writes weights, biases, the loss and fitted preprocessing parameters
+// to w
+func (net *Network) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(net.model())
+}
+
+func (net *Network) model() *model {
+	m := &model{
+		Version:    modelVersion,
+		Sizes:      net.Sizes(),
+		Weights:    net.weights,
+		Biases:     net.biases,
+		Preprocess: net.preprocess,
+		Loss:       net.loss.String(),
+	}
+	for _, a := range net.activations {
+		m.Activations = append(m.Activations, a.Name)
+	}
+	return m
+}
+
+// Save writes the network to filename, see Encode
+func (net *Network) Save(filename string) error {
+	return writeFile(filename, net.Encode)
+}
+
+// writeFile writes filename by encode, the file is written to a temporary
+// file which replaces filename on success, so that an interrupted write never
+// leaves a truncated model
+func writeFile(filename string, encode func(io.Writer) error) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}()
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// Decode reads a Network written by Encode, ErrModel is returned if the model
+// is inconsistent or of an unsupported version. Checkpoints are decoded as
+// networks without their optimizer state.
+func Decode(r io.Reader) (*Network, error) {
+	net, _, err := decode(r)
+	return net, err
+}
+
+func decode(r io.Reader) (*Network, *model, error) {
+	var m model
+	if err := gob.NewDecoder(r).Decode(&m); err != nil {
+		return nil, nil, err
+	}
+	net, err := m.network()
+	if err != nil {
+		return nil, nil, err
+	}
+	return net, &m, nil
+}
+
+func (m *model) network() (*Network, error) {
+	if m.Version != modelVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrModel, m.Version)
+	}
+	n := len(m.Sizes) - 1
+	if n < 1 || len(m.Weights) != n || len(m.Biases) != n {
+		return nil, fmt.Errorf("%w: inconsistent layers", ErrModel)
+	}
+	// sizes are only trusted as far as decoded parameters match them, the
+	// network is built from the parameters so that a crafted model can't
+	// make it allocate more than the model holds
+	for i := 0; i < n; i++ {
+		w, b := m.Weights[i], m.Biases[i]
+		if m.Sizes[i] <= 0 || m.Sizes[i+1] <= 0 || w == nil || b == nil ||
+			w.RowCount() != m.Sizes[i+1] || w.ColCount() != m.Sizes[i] || b.RowCount() != m.Sizes[i+1] || b.ColCount() != 1 {
+			return nil, fmt.Errorf("%w: layer %d: inconsistent shape", ErrModel, i)
+		}
+	}
+	net := &Network{
+		weights:     m.Weights,
+		biases:      m.Biases,
+		activations: make([]Activation, n-1),
+		loss:        CubicLoss{},
+	}
+	for i := range net.activations {
+		net.activations[i] = Sigmoid
+	}
+	var err error
+	if len(m.Activations) > 0 {
+		activations := make([]Activation, len(m.Activations))
+		for i, name := range m.Activations {
+			if activations[i], err = ParseActivation(name); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrModel, err)
+			}
+		}
+		if err := net.SetActivations(activations...); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrModel, err)
+		}
+	}
+	net.preprocess = m.Preprocess
+	if net.loss, err = ParseLoss(m.Loss); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModel, err)
+	}
+	return net, nil
+}
+
+// Load reads a Network saved by Save or Checkpoint.Save
+func Load(filename string) (*Network, error) {
+	var net *Network
+	err := readFile(filename, func(r io.Reader) (err error) {
+		net, err = Decode(r)
+		return err
+	})
+	return net, err
+}
+
+func readFile(filename string, decode func(io.Reader) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := decode(file); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// Checkpoint is a network in training with the state of its optimizer and
+// learning rate scheduler, it's saved after completed epochs so that training
+// can be resumed from the last completed epoch as if it wasn't interrupted
+type Checkpoint struct {
+	Network   *Network
+	Optimizer Optimizer
+	// Scheduler is nil if the learning rate is constant
+	Scheduler Scheduler
+	// Epoch is number of completed epochs
+	Epoch int
+	// Epochs is the total number of epochs of the run, 0 if unknown.
+	// Schedulers decide learning rates by it, so a run with a schedule must be
+	// resumed with the same number of epochs.
+	Epochs int
+}
+
+// Encode writes the network, the optimizer, the scheduler and the epoch to w,
+// the network can be read by Decode
+func (c *Checkpoint) Encode(w io.Writer) error {
+	m := c.Network.model()
+	m.Optimizer, m.Scheduler, m.Epoch, m.Epochs = c.Optimizer, c.Scheduler, c.Epoch, c.Epochs
+	return gob.NewEncoder(w).Encode(m)
+}
+
+// Save writes the checkpoint to filename, see Encode
+func (c *Checkpoint) Save(filename string) error {
+	return writeFile(filename, c.Encode)
+}
+
+// DecodeCheckpoint reads a Checkpoint written by Checkpoint.Encode, the
+// optimizer is nil if the network was written by Network.Encode. ErrModel is
+// returned if the optimizer state doesn't match parameters of the network.
+func DecodeCheckpoint(r io.Reader) (*Checkpoint, error) {
+	net, m, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if m.Epoch < 0 || m.Epochs < 0 {
+		return nil, fmt.Errorf("%w: invalid epoch %d of %d", ErrModel, m.Epoch, m.Epochs)
+	}
+	if err := checkOptimizer(m.Optimizer, net); err != nil {
+		return nil, fmt.Errorf("%w: optimizer %v: %v", ErrModel, m.Optimizer, err)
+	}
+	if m.Scheduler != nil {
+		// parameters are checked by parsing them
+		if _, err := ParseScheduler(m.Scheduler.String()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrModel, err)
+		}
+	}
+	return &Checkpoint{Network: net, Optimizer: m.Optimizer, Scheduler: m.Scheduler, Epoch: m.Epoch, Epochs: m.Epochs}, nil
+}
+
+// LoadCheckpoint reads a Checkpoint saved by Checkpoint.Save
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	var c *Checkpoint
+	err := readFile(filename, func(r io.Reader) (err error) {
+		c, err = DecodeCheckpoint(r)
+		return err
+	})
+	return c, err
+}
+
+// checkOptimizer checks that state of optimizer is empty or shaped like
+// parameters of net
+func checkOptimizer(optimizer Optimizer, net *Network) error {
+	var states [][]*mathx.Matrix
+	switch o := optimizer.(type) {
+	case *SGD:
+		states = [][]*mathx.Matrix{o.Velocity}
+	case *Adagrad:
+		states = [][]*mathx.Matrix{o.Sum}
+	case *RMSProp:
+		states = [][]*mathx.Matrix{o.MeanSquare}
+	case *Adam:
+		states = [][]*mathx.Matrix{o.M, o.V}
+	}
+	params := net.params(net.weights, net.biases)
+	for _, state := range states {
+		if len(state) == 0 {
+			continue
+		}
+		if len(state) != len(params) {
+			return fmt.Errorf("state of %d parameters, network has %d", len(state), len(params))
+		}
+		for i, s := range state {
+			p := params[i].Value
+			if s == nil || s.RowCount() != p.RowCount() || s.ColCount() != p.ColCount() {
+				return fmt.Errorf("state of parameter %d: inconsistent shape", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package nn implements a fully connected feedforward network which is
+// trained by mini-batch gradient descent on datasets of package dataset.
+//
+// A Network is safe for concurrent inference by Forward, Predict,
+// PredictProba and Evaluate, but must not be used while it's being trained.
+package nn
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+)
+
+var (
+	ErrLayers = errors.New("invalid layers")
+	ErrShape  = errors.New("shape mismatch")
+	ErrModel  = errors.New("invalid model")
+)
+
+// Network is a fully connected network, the activation of the output layer is
+// decided by its Loss
+type Network struct {
+	weights []*mathx.Matrix
+	biases  []*mathx.Matrix
+	// activations of hidden layers, the loss decides the activation of the
+	// output layer
+	activations []Activation
+	loss        Loss
+	// preprocess is fitted on training set and applied to every input
+	preprocess *dataset.Pipeline
+}
+
+// New creates a network with randomly initialized parameters, Sigmoid hidden
+// layers and CubicLoss, sizes are numbers of nodes of layers from the input
+// layer to the output layer. ErrLayers is returned if there are less than 2 layers or a layer is
+// empty.
+func New(sizes []int) (*Network, error) {
+	if len(sizes) < 2 {
+		return nil, fmt.Errorf("%w: %d layers, at least 2 required", ErrLayers, len(sizes))
+	}
+	for i, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("%w: layer %d has %d nodes", ErrLayers, i, size)
+		}
+	}
+	net := &Network{loss: CubicLoss{}}
+	n := len(sizes) - 1
+	net.weights = make([]*mathx.Matrix, n)
+	net.biases = make([]*mathx.Matrix, n)
+	net.activations = make([]Activation, n-1)
+	for i := 0; i < n; i++ {
+		net.weights[i] = mathx.NewMatrix(sizes[i+1], sizes[i]).RandInit(-0.001, 0.001)
+		net.biases[i] = mathx.NewMatrix(sizes[i+1], 1).RandInit(-0.001, 0.001)
+		if i+1 < n {
+			net.activations[i] = Sigmoid
+		}
+	}
+	return net, nil
+}
+
+// Sizes returns numbers of nodes of layers
+func (net *Network) Sizes() []int {
+	sizes := []int{net.InputSize()}
+	for _, w := range net.weights {
+		sizes = append(sizes, w.RowCount())
+	}
+	return sizes
+}
+
+// InputSize returns number of inputs
+func (net *Network) InputSize() int { return net.weights[0].ColCount() }
+
+// OutputSize returns number of outputs, i.e. number of classes
+func (net *Network) OutputSize() int { return net.weights[len(net.weights)-1].RowCount() }
+
+// NumParams returns number of weights and biases
+func (net *Network) NumParams() int {
+	n := 0
+	for i := range net.weights {
+		n += net.weights[i].Size() + net.biases[i].Size()
+	}
+	return n
+}
+
+// Activations returns activations of hidden layers
+func (net *Network) Activations() []Activation {
+	return append([]Activation(nil), net.activations...)
+}
+
+// SetActivations sets activations of hidden layers, a single activation is
+// used by all hidden layers. ErrLayers is returned if number of activations
+// doesn't match.
+func (net *Network) SetActivations(activations ...Activation) error {
+	n := len(net.activations)
+	switch len(activations) {
+	case n:
+		copy(net.activations, activations)
+	case 1:
+		for i := range net.activations {
+			net.activations[i] = activations[0]
+		}
+	default:
+		return fmt.Errorf("%w: %d activations for %d hidden layers", ErrLayers, len(activations), n)
+	}
+	return nil
+}
+
+// Loss returns the loss which the network is trained with
+func (net *Network) Loss() Loss { return net.loss }
+
+// SetLoss sets the loss, it should be set before training since it decides
+// the output activation
+func (net *Network) SetLoss(loss Loss) { net.loss = loss }
+
+// Preprocess returns the preprocessing pipeline applied to inputs, nil if none
+func (net *Network) Preprocess() *dataset.Pipeline { return net.preprocess }
+
+// SetPreprocess sets a pipeline fitted on the training set which is applied to
+// every input before the first layer
+func (net *Network) SetPreprocess(p *dataset.Pipeline) { net.preprocess = p }
+
+func (net *Network) checkInput(input *mathx.Matrix) error {
+	if input == nil || input.RowCount() != net.InputSize() || input.ColCount() != 1 {
+		rows, cols := 0, 0
+		if input != nil {
+			rows, cols = input.RowCount(), input.ColCount()
+		}
+		return fmt.Errorf("%w: input is %dx%d, want %dx1", ErrShape, rows, cols, net.InputSize())
+	}
+	return nil
+}
+
+func (net *Network) checkDataset(d *dataset.Dataset) error {
+	if d.ImageSize() != net.InputSize() || d.NumClasses != net.OutputSize() {
+		return fmt.Errorf("%w: dataset has %d pixels and %d classes, network has %d inputs and %d outputs",
+			ErrShape, d.ImageSize(), d.NumClasses, net.InputSize(), net.OutputSize())
+	}
+	return nil
+}
+
+// Forward returns outputs of the output layer for an input column vector of
+// InputSize() unpreprocessed pixels in [0, 1]. Outputs are activations of
+// the loss, e.g. sigmoid or softmax. ErrShape is returned if input has a
+// different shape.
+func (net *Network) Forward(input *mathx.Matrix) (*mathx.Matrix, error) {
+	if err := net.checkInput(input); err != nil {
+		return nil, err
+	}
+	return net.feedforward(input), nil
+}
+
+// PredictProba returns probabilities of classes of input which sum to 1,
+// outputs of the network are normalized if they are not softmax outputs
+func (net *Network) PredictProba(input *mathx.Matrix) (*mathx.Matrix, error) {
+	output, err := net.Forward(input)
+	if err != nil {
+		return nil, err
+	}
+	if sum := output.Accumulate(mathx.Identity); sum > 0 {
+		output.ScaleWith(1 / sum)
+	}
+	return output, nil
+}
+
+// Predict returns the most probable class of input
+func (net *Network) Predict(input *mathx.Matrix) (int, error) {
+	output, err := net.Forward(input)
+	if err != nil {
+		return 0, err
+	}
+	i, _, _ := output.MaxElem()
+	return i, nil
+}
+
+// Evaluate returns the ratio of samples of d which are predicted correctly, 0
+// if d is empty. ErrShape is returned if images or classes of d don't match
+// the network.
+func (net *Network) Evaluate(d *dataset.Dataset) (mathx.Float, error) {
+	if err := net.checkDataset(d); err != nil {
+		return 0, err
+	}
+	return net.evaluate(d), nil
+}
+
+func (net *Network) evaluate(d *dataset.Dataset) mathx.Float {
+	accuracy, _ := net.measure(d, false)
+	return accuracy
+}
+
+// measure returns accuracy on d and the mean loss if withLoss is true
+func (net *Network) measure(d *dataset.Dataset, withLoss bool) (accuracy, loss mathx.Float) {
+	total := d.Len()
+	if total == 0 {
+		return 0, 0
+	}
+	num := 0
+	for i := 0; i < total; i++ {
+		sample := d.Sample(i)
+		z := net.logits(sample.Input)
+		j, _, _ := net.loss.Output(z).MaxElem()
+		if j == d.Label(i) {
+			num++
+		}
+		if withLoss {
+			loss += net.loss.Value(z, sample.Label)
+		}
+	}
+	return mathx.Float(num) / mathx.Float(total), loss / mathx.Float(total)
+}
+
+func (net *Network) preprocessInput(input *mathx.Matrix) *mathx.Matrix {
+	if net.preprocess != nil {
+		return net.preprocess.Apply(input)
+	}
+	return input
+}
+
+func (net *Network) feedforward(input *mathx.Matrix) *mathx.Matrix {
+	return net.loss.Output(net.logits(input))
+}
+
+// logits returns the weighted input z of the output layer
+func (net *Network) logits(input *mathx.Matrix) *mathx.Matrix {
+	input = net.preprocessInput(input)
+	n := len(net.weights)
+	for i := 0; i+1 < n; i++ {
+		input = net.weights[i].Mul(input).AddWith(net.biases[i]).MapWith(net.activations[i].f)
+	}
+	return net.weights[n-1].Mul(input).AddWith(net.biases[n-1])
+}
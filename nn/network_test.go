@@ -0,0 +1,164 @@
+package nn
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+// stripes has 2x2 images of a bright left (class 0) or right (class 1) column
+func stripes(n int) *dataset.Dataset {
+	d := &dataset.Dataset{Rows: 2, Cols: 2, NumClasses: 2}
+	for i := 0; i < n; i++ {
+		label := uint8(i % 2)
+		pix := []uint8{255, 0, 255, 0}
+		if label == 1 {
+			pix = []uint8{0, 255, 0, 255}
+		}
+		d.Images = append(d.Images, pix...)
+		d.Labels = append(d.Labels, label)
+	}
+	return d
+}
+
+func TestNew(t *testing.T) {
+	for _, sizes := range [][]int{nil, {4}, {4, 0, 2}, {4, -1}} {
+		_, err := New(sizes)
+		assert.True(t, errors.Is(err, ErrLayers), "%v: %v", sizes, err)
+	}
+	net, err := New([]int{4, 3, 2})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{4, 3, 2}, net.Sizes())
+		assert.Equal(t, 4, net.InputSize())
+		assert.Equal(t, 2, net.OutputSize())
+		assert.Equal(t, 4*3+3+3*2+2, net.NumParams())
+		assert.Equal(t, CubicLoss{}, net.Loss())
+	}
+}
+
+func TestTrain(t *testing.T) {
+	for _, loss := range []Loss{CubicLoss{}, CrossEntropy{}} {
+		net, err := New([]int{4, 3, 2})
+		if !assert.NoError(t, err) {
+			return
+		}
+		net.SetLoss(loss)
+		var epochs []EpochStats
+		err = net.Train(context.Background(), dataset.NewLoader(stripes(200), 10, 1), TrainOptions{
+			Epochs:     20,
+			Validation: stripes(20),
+			OnEpoch:    func(s EpochStats) { epochs = append(epochs, s) },
+		})
+		if !assert.NoError(t, err, "%v", loss) {
+			continue
+		}
+		assert.Equal(t, 20, len(epochs))
+		assert.Equal(t, 20, epochs[19].Epoch)
+		assert.Equal(t, mathx.Float(1), epochs[19].ValidationAccuracy, "%v", loss)
+		assert.True(t, epochs[19].Loss < epochs[0].Loss, "%v: %v", loss, epochs)
+		assert.True(t, epochs[19].ValidationLoss > 0, "%v: %v", loss, epochs)
+
+		accuracy, err := net.Evaluate(stripes(10))
+		assert.NoError(t, err)
+		assert.Equal(t, mathx.Float(1), accuracy)
+		input := stripes(2).Input(1)
+		class, err := net.Predict(input)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, class)
+		proba, err := net.PredictProba(input)
+		if assert.NoError(t, err) {
+			assert.InDelta(t, 1, float64(proba.Accumulate(mathx.Identity)), 1e-9)
+		}
+	}
+}
+
+func TestShapeErrors(t *testing.T) {
+	net, err := New([]int{4, 3, 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = net.Forward(mathx.NewMatrix(5, 1))
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	_, err = net.Predict(mathx.NewMatrix(4, 2))
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	_, err = net.PredictProba(nil)
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+
+	wrong := &dataset.Dataset{Rows: 2, Cols: 2, NumClasses: 3}
+	_, err = net.Evaluate(wrong)
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	err = net.Train(context.Background(), dataset.NewLoader(wrong, 1, 1), TrainOptions{})
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	err = net.Train(context.Background(), dataset.NewLoader(stripes(2), 1, 1), TrainOptions{Validation: wrong})
+	assert.NoError(t, err, "empty validation set is ignored")
+	loader := dataset.NewLoader(stripes(2), 1, 1)
+	loader.Sampler = &dataset.WeightedSampler{Weights: make([]mathx.Float, 5)}
+	err = net.Train(context.Background(), loader, TrainOptions{})
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	loader.Sampler = &dataset.WeightedSampler{Weights: make([]mathx.Float, 2)}
+	err = net.Train(context.Background(), loader, TrainOptions{})
+	assert.Error(t, err, "no positive sampling weight")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = net.Train(ctx, dataset.NewLoader(stripes(10), 1, 1), TrainOptions{})
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	net, err := New([]int{4, 3, 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	net.SetLoss(CrossEntropy{Smoothing: 0.2})
+	assert.NoError(t, net.SetActivations(Tanh))
+	assert.True(t, errors.Is(net.SetActivations(Tanh, ReLU), ErrLayers))
+	var buf bytes.Buffer
+	if !assert.NoError(t, net.Encode(&buf)) {
+		return
+	}
+	data := buf.Bytes()
+	net2, err := Decode(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, net.Sizes(), net2.Sizes())
+		assert.Equal(t, net.Loss(), net2.Loss())
+		assert.Equal(t, "tanh", net2.Activations()[0].Name)
+		input := stripes(1).Input(0)
+		out, _ := net.Forward(input)
+		out2, _ := net2.Forward(input)
+		assert.Equal(t, out, out2)
+	}
+
+	_, err = Decode(bytes.NewReader(data[:len(data)/2]))
+	assert.Error(t, err)
+
+	// sizes which don't match parameters are rejected before allocating
+	buf.Reset()
+	m := net.model()
+	m.Sizes = []int{1 << 20, 1 << 20}
+	m.Weights, m.Biases = m.Weights[:1], m.Biases[:1]
+	assert.NoError(t, gob.NewEncoder(&buf).Encode(m))
+	_, err = Decode(&buf)
+	assert.True(t, errors.Is(err, ErrModel), "%v", err)
+
+	q := Quantize(net, mathx.PerRow)
+	_, err = q.Evaluate(stripes(10))
+	assert.NoError(t, err)
+	_, err = q.Evaluate(&dataset.Dataset{Rows: 1, Cols: 4, NumClasses: 3})
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	_, err = q.Predict(mathx.NewMatrix(3, 1))
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	_, err = q.PredictSample(&dataset.Sample{Input: mathx.NewMatrix(3, 1)})
+	assert.True(t, errors.Is(err, ErrShape), "%v", err)
+	d := stripes(1)
+	if class, err := q.PredictSample(d.Sample(0)); assert.NoError(t, err) {
+		want, _ := q.Predict(d.Input(0))
+		assert.Equal(t, want, class)
+	}
+}
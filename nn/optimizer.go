@@ -0,0 +1,223 @@
+package nn
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+func init() {
+	gob.Register(&SGD{})
+	gob.Register(&Adagrad{})
+	gob.Register(&RMSProp{})
+	gob.Register(&Adam{})
+}
+
+// Param is a parameter of a network and its gradient of a mini-batch
+type Param struct {
+	Value, Grad *mathx.Matrix
+	// Decay is true if the parameter is subject to weight decay, i.e. it's a
+	// weight and not a bias
+	Decay bool
+}
+
+// Optimizer updates parameters by their gradients. Optimizers keep state per
+// parameter, which is indexed by the position of the parameter in params, so
+// they must be used by a single network. Their state is exported so that it
+// is saved in checkpoints.
+type Optimizer interface {
+	// Step updates values of params by their gradients with learning rate lr
+	Step(params []Param, lr mathx.Float)
+	// String returns the spec of the optimizer accepted by ParseOptimizer
+	String() string
+}
+
+// newState returns state matrices shaped like params if state doesn't match
+func newState(state []*mathx.Matrix, params []Param) []*mathx.Matrix {
+	if len(state) == len(params) {
+		return state
+	}
+	state = make([]*mathx.Matrix, len(params))
+	for i, p := range params {
+		state[i] = mathx.NewMatrix(p.Value.RowCount(), p.Value.ColCount())
+	}
+	return state
+}
+
+func sqrt(x mathx.Float) mathx.Float { return mathx.Float(math.Sqrt(float64(x))) }
+
+// SGD is stochastic gradient descent, with momentum if Momentum is not 0 and
+// Nesterov's accelerated gradient if Nesterov is true
+type SGD struct {
+	Momentum mathx.Float
+	Nesterov bool
+	Velocity []*mathx.Matrix
+}
+
+func (o *SGD) Step(params []Param, lr mathx.Float) {
+	if o.Momentum == 0 {
+		for _, p := range params {
+			p.Value.SubWith(p.Grad.Scale(lr))
+		}
+		return
+	}
+	o.Velocity = newState(o.Velocity, params)
+	for i, p := range params {
+		w, g, v := p.Value.Slice(), p.Grad.Slice(), o.Velocity[i].Slice()
+		for j := range w {
+			prev := v[j]
+			v[j] = o.Momentum*v[j] - lr*g[j]
+			if o.Nesterov {
+				// look ahead along the velocity
+				w[j] += -o.Momentum*prev + (1+o.Momentum)*v[j]
+			} else {
+				w[j] += v[j]
+			}
+		}
+	}
+}
+
+func (o *SGD) String() string {
+	switch {
+	case o.Momentum == 0:
+		return "sgd"
+	case o.Nesterov:
+		return "nesterov=" + formatFloat(o.Momentum)
+	}
+	return "momentum=" + formatFloat(o.Momentum)
+}
+
+// Adagrad scales the learning rate of each parameter by the inverse root of
+// its sum of squared gradients
+type Adagrad struct {
+	Epsilon mathx.Float
+	Sum     []*mathx.Matrix
+}
+
+func (o *Adagrad) Step(params []Param, lr mathx.Float) {
+	o.Sum = newState(o.Sum, params)
+	for i, p := range params {
+		w, g, s := p.Value.Slice(), p.Grad.Slice(), o.Sum[i].Slice()
+		for j := range w {
+			s[j] += g[j] * g[j]
+			w[j] -= lr * g[j] / (sqrt(s[j]) + o.Epsilon)
+		}
+	}
+}
+
+func (o *Adagrad) String() string { return "adagrad" }
+
+// RMSProp scales the learning rate of each parameter by the inverse root of
+// the moving average of its squared gradients
+type RMSProp struct {
+	Decay, Epsilon mathx.Float
+	MeanSquare     []*mathx.Matrix
+}
+
+func (o *RMSProp) Step(params []Param, lr mathx.Float) {
+	o.MeanSquare = newState(o.MeanSquare, params)
+	for i, p := range params {
+		w, g, s := p.Value.Slice(), p.Grad.Slice(), o.MeanSquare[i].Slice()
+		for j := range w {
+			s[j] = o.Decay*s[j] + (1-o.Decay)*g[j]*g[j]
+			w[j] -= lr * g[j] / (sqrt(s[j]) + o.Epsilon)
+		}
+	}
+}
+
+func (o *RMSProp) String() string { return "rmsprop=" + formatFloat(o.Decay) }
+
+// Adam keeps bias-corrected moving averages of gradients and squared gradients
+// (Kingma and Ba, 2014). It's AdamW if WeightDecay is not 0, weights are
+// decayed by lr*WeightDecay*w separately from the gradient (Loshchilov and
+// Hutter, 2017).
+type Adam struct {
+	Beta1, Beta2, Epsilon mathx.Float
+	WeightDecay           mathx.Float
+	// T is the number of steps taken
+	T    int
+	M, V []*mathx.Matrix
+}
+
+func (o *Adam) Step(params []Param, lr mathx.Float) {
+	o.M, o.V = newState(o.M, params), newState(o.V, params)
+	o.T++
+	c1 := 1 - mathx.Float(math.Pow(float64(o.Beta1), float64(o.T)))
+	c2 := 1 - mathx.Float(math.Pow(float64(o.Beta2), float64(o.T)))
+	for i, p := range params {
+		w, g, m, v := p.Value.Slice(), p.Grad.Slice(), o.M[i].Slice(), o.V[i].Slice()
+		decay := o.WeightDecay != 0 && p.Decay
+		for j := range w {
+			m[j] = o.Beta1*m[j] + (1-o.Beta1)*g[j]
+			v[j] = o.Beta2*v[j] + (1-o.Beta2)*g[j]*g[j]
+			if decay {
+				w[j] -= lr * o.WeightDecay * w[j]
+			}
+			w[j] -= lr * (m[j] / c1) / (sqrt(v[j]/c2) + o.Epsilon)
+		}
+	}
+}
+
+func (o *Adam) String() string {
+	if o.WeightDecay != 0 {
+		return "adamw=" + formatFloat(o.WeightDecay)
+	}
+	return "adam"
+}
+
+// ParseOptimizer parses an optimizer spec: sgd, momentum[=mu], nesterov[=mu],
+// adagrad, rmsprop[=decay], adam or adamw[=decay], SGD returned if spec is
+// empty
+func ParseOptimizer(spec string) (Optimizer, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), "=")
+	param := func(def mathx.Float) (mathx.Float, error) {
+		if !hasArg {
+			return def, nil
+		}
+		x, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+		if err != nil || x < 0 || x >= 1 {
+			return 0, fmt.Errorf("invalid parameter %q of optimizer %s", arg, name)
+		}
+		return mathx.Float(x), nil
+	}
+	var (
+		optimizer Optimizer
+		err       error
+	)
+	switch name {
+	case "", "sgd", "adagrad", "adam":
+		if hasArg {
+			return nil, fmt.Errorf("optimizer %s has no parameter", name)
+		}
+		switch name {
+		case "adagrad":
+			optimizer = &Adagrad{Epsilon: 1e-8}
+		case "adam":
+			optimizer = &Adam{Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+		default:
+			optimizer = &SGD{}
+		}
+	case "momentum", "nesterov":
+		o := &SGD{Nesterov: name == "nesterov"}
+		o.Momentum, err = param(0.9)
+		optimizer = o
+	case "rmsprop":
+		o := &RMSProp{Epsilon: 1e-8}
+		o.Decay, err = param(0.9)
+		optimizer = o
+	case "adamw":
+		o := &Adam{Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+		o.WeightDecay, err = param(0.01)
+		optimizer = o
+	default:
+		return nil, fmt.Errorf("unknown optimizer %q", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return optimizer, nil
+}
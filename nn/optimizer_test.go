@@ -0,0 +1,158 @@
+package nn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimizers(t *testing.T) {
+	for _, spec := range []string{"sgd", "momentum", "nesterov=0.5", "adagrad", "rmsprop", "adam", "adamw=0.1"} {
+		optimizer, err := ParseOptimizer(spec)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		// minimize (w-3)^2 + (b+1)^2
+		w, b := mathx.NewMatrixWithValue(1, 1, 0), mathx.NewMatrixWithValue(1, 1, 0)
+		lr := mathx.Float(0.1)
+		for i := 0; i < 2000; i++ {
+			params := []Param{
+				{Value: w, Grad: mathx.NewMatrixWithValue(1, 1, 2*(w.Get(0, 0)-3)), Decay: true},
+				{Value: b, Grad: mathx.NewMatrixWithValue(1, 1, 2*(b.Get(0, 0)+1))},
+			}
+			optimizer.Step(params, lr)
+		}
+		// decoupled weight decay pulls w towards 0
+		want := 3.0
+		if spec == "adamw=0.1" {
+			want = 2.9
+		}
+		assert.InDelta(t, want, float64(w.Get(0, 0)), 0.1, spec)
+		assert.InDelta(t, -1, float64(b.Get(0, 0)), 0.05, spec)
+	}
+}
+
+func TestParseOptimizer(t *testing.T) {
+	for spec, want := range map[string]string{
+		"":             "sgd",
+		"momentum":     "momentum=0.9",
+		"nesterov=0.8": "nesterov=0.8",
+		"rmsprop":      "rmsprop=0.9",
+		"adam":         "adam",
+		"adamw":        "adamw=0.01",
+	} {
+		optimizer, err := ParseOptimizer(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, want, optimizer.String())
+		}
+	}
+	for _, spec := range []string{"lbfgs", "adam=0.9", "momentum=1", "rmsprop=x"} {
+		_, err := ParseOptimizer(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// noisyStripes is stripes with random intensities, so that batches differ
+func noisyStripes(n int) *dataset.Dataset {
+	d := stripes(n)
+	rng := rand.New(rand.NewSource(1))
+	for i, x := range d.Images {
+		d.Images[i] = x/2 + uint8(rng.Intn(128))
+	}
+	return d
+}
+
+func TestResume(t *testing.T) {
+	train := func(net *Network, optimizer Optimizer, initial, epochs int) {
+		loader := dataset.NewLoader(noisyStripes(100), 10, 1)
+		loader.Shuffle = true
+		err := net.Train(context.Background(), loader, TrainOptions{
+			Epochs:       epochs,
+			InitialEpoch: initial,
+			Optimizer:    optimizer,
+			Seed:         7,
+		})
+		assert.NoError(t, err)
+	}
+	for _, spec := range []string{"nesterov", "adagrad", "rmsprop", "adamw"} {
+		net, err := New([]int{4, 3, 2})
+		if !assert.NoError(t, err) {
+			return
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, net.Encode(&buf))
+		resumed, err := Decode(&buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		optimizer, _ := ParseOptimizer(spec)
+		train(net, optimizer, 0, 4)
+
+		optimizer, _ = ParseOptimizer(spec)
+		train(resumed, optimizer, 0, 2)
+		buf.Reset()
+		assert.NoError(t, (&Checkpoint{Network: resumed, Optimizer: optimizer, Epoch: 2}).Encode(&buf))
+		checkpoint, err := DecodeCheckpoint(&buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 2, checkpoint.Epoch)
+		assert.Equal(t, optimizer, checkpoint.Optimizer, spec)
+		train(checkpoint.Network, checkpoint.Optimizer, checkpoint.Epoch, 4)
+
+		for i := range net.weights {
+			assert.True(t, net.weights[i].Equal(checkpoint.Network.weights[i]), "%s: weights of layer %d", spec, i)
+			assert.True(t, net.biases[i].Equal(checkpoint.Network.biases[i]), "%s: biases of layer %d", spec, i)
+		}
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	net, err := New([]int{4, 3, 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	optimizer := &Adam{Beta1: 0.9, Beta2: 0.999, M: []*mathx.Matrix{mathx.NewMatrix(1, 1)}}
+	var buf bytes.Buffer
+	assert.NoError(t, (&Checkpoint{Network: net, Optimizer: optimizer}).Encode(&buf))
+	_, err = DecodeCheckpoint(&buf)
+	assert.True(t, errors.Is(err, ErrModel), "%v", err)
+
+	// state of schedulers is saved, their parameters are checked
+	scheduler := &Warmup{Epochs: 1, Then: &ReduceOnPlateau{Factor: 0.5, Patience: 2, Scale: 0.5, Best: 0.7, Wait: 1}}
+	buf.Reset()
+	assert.NoError(t, (&Checkpoint{Network: net, Optimizer: &SGD{}, Scheduler: scheduler, Epoch: 3, Epochs: 10}).Encode(&buf))
+	checkpoint, err := DecodeCheckpoint(&buf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, scheduler, checkpoint.Scheduler)
+		assert.Equal(t, 10, checkpoint.Epochs)
+	}
+	buf.Reset()
+	assert.NoError(t, (&Checkpoint{Network: net, Scheduler: &StepDecay{}}).Encode(&buf))
+	_, err = DecodeCheckpoint(&buf)
+	assert.True(t, errors.Is(err, ErrModel), "%v", err)
+
+	// a model is a checkpoint without optimizer
+	buf.Reset()
+	assert.NoError(t, net.Encode(&buf))
+	checkpoint, err = DecodeCheckpoint(&buf)
+	if assert.NoError(t, err) {
+		assert.Nil(t, checkpoint.Optimizer)
+		assert.Nil(t, checkpoint.Scheduler)
+		assert.Equal(t, 0, checkpoint.Epoch)
+	}
+}
+
+func TestDefaultOptimizerLearningRate(t *testing.T) {
+	assert.Equal(t, DefaultLearningRate(CubicLoss{}), DefaultOptimizerLearningRate(CubicLoss{}, nil))
+	assert.Equal(t, DefaultLearningRate(CubicLoss{}), DefaultOptimizerLearningRate(CubicLoss{}, &SGD{}))
+	assert.Equal(t, DefaultLearningRate(CubicLoss{})/2, DefaultOptimizerLearningRate(CubicLoss{}, &SGD{Momentum: 0.5}))
+	assert.Equal(t, mathx.Float(0.001), DefaultOptimizerLearningRate(CubicLoss{}, &Adam{}))
+}
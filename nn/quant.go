@@ -0,0 +1,98 @@
+package nn
+
+import (
+	"fmt"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+)
+
+// QuantizedNetwork is an int8 copy of a trained Network for inference only
+type QuantizedNetwork struct {
+	weights     []*mathx.QuantizedMatrix
+	biases      []*mathx.QuantizedMatrix
+	activations []Activation
+	loss        Loss
+	// preprocess is shared with the float network
+	preprocess *dataset.Pipeline
+}
+
+// Quantize returns an int8 copy of net, weights and biases are quantized per
+// tensor or per row by granularity
+func Quantize(net *Network, granularity mathx.QuantGranularity) *QuantizedNetwork {
+	n := len(net.weights)
+	qnet := &QuantizedNetwork{
+		weights:     make([]*mathx.QuantizedMatrix, n),
+		biases:      make([]*mathx.QuantizedMatrix, n),
+		activations: net.Activations(),
+		loss:        net.loss,
+
+		preprocess: net.preprocess,
+	}
+	for i := 0; i < n; i++ {
+		qnet.weights[i] = mathx.Quantize(net.weights[i], granularity)
+		qnet.biases[i] = mathx.Quantize(net.biases[i], granularity)
+	}
+	return qnet
+}
+
+// Size returns number of bytes used by parameters
+func (qnet *QuantizedNetwork) Size() int {
+	size := 0
+	for i := range qnet.weights {
+		size += qnet.weights[i].Size() + qnet.biases[i].Size()
+	}
+	return size
+}
+
+func (qnet *QuantizedNetwork) feedforward(input *mathx.Matrix) *mathx.Matrix {
+	if qnet.preprocess != nil {
+		input = qnet.preprocess.Apply(input)
+	}
+	n := len(qnet.weights)
+	for i := 0; i < n; i++ {
+		x := mathx.Quantize(input, mathx.PerTensor)
+		input = qnet.weights[i].MulDequantize(x).AddWith(qnet.biases[i].Dequantize())
+		if i+1 < n {
+			input.MapWith(qnet.activations[i].f)
+		}
+	}
+	return qnet.loss.Output(input)
+}
+
+// Predict returns the most probable class of input, see Network.Predict
+func (qnet *QuantizedNetwork) Predict(input *mathx.Matrix) (int, error) {
+	if input == nil || input.RowCount() != qnet.weights[0].ColCount() || input.ColCount() != 1 {
+		return 0, fmt.Errorf("%w: input doesn't match %d inputs", ErrShape, qnet.weights[0].ColCount())
+	}
+	i, _, _ := qnet.feedforward(input).MaxElem()
+	return i, nil
+}
+
+// PredictSample returns the most probable class of the input of data
+func (qnet *QuantizedNetwork) PredictSample(data *dataset.Sample) (int, error) {
+	if data == nil {
+		return 0, fmt.Errorf("%w: nil sample", ErrShape)
+	}
+	return qnet.Predict(data.Input)
+}
+
+// Evaluate returns the ratio of samples of d which are predicted correctly,
+// see Network.Evaluate
+func (qnet *QuantizedNetwork) Evaluate(d *dataset.Dataset) (mathx.Float, error) {
+	if d.ImageSize() != qnet.weights[0].ColCount() || d.NumClasses != qnet.weights[len(qnet.weights)-1].RowCount() {
+		return 0, fmt.Errorf("%w: dataset doesn't match the network", ErrShape)
+	}
+	total := d.Len()
+	if total == 0 {
+		return 0, nil
+	}
+	num := 0
+	for i := 0; i < total; i++ {
+		j, _, _ := qnet.feedforward(d.Input(i)).MaxElem()
+		if j == d.Label(i) {
+			num++
+		}
+	}
+	return mathx.Float(num) / mathx.Float(total), nil
+}
@@ -0,0 +1,317 @@
+package nn
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mkideal/mnist/mathx"
+)
+
+func init() {
+	gob.Register(&StepDecay{})
+	gob.Register(&ExponentialDecay{})
+	gob.Register(&CosineAnnealing{})
+	gob.Register(&OneCycle{})
+	gob.Register(&Warmup{})
+	gob.Register(&ReduceOnPlateau{})
+}
+
+// Scheduler decides the learning rate of each epoch. Like optimizers,
+// schedulers which keep state export it so that it's saved in checkpoints.
+type Scheduler interface {
+	// LearningRate returns the learning rate of epoch, the 0-based index of an
+	// epoch of a run of epochs, base is TrainOptions.LearningRate
+	LearningRate(epoch, epochs int, base mathx.Float) mathx.Float
+	// String returns the spec of the scheduler accepted by ParseScheduler
+	String() string
+}
+
+// Observer is implemented by schedulers which adapt to training progress,
+// Observe is called after each epoch with its stats
+type Observer interface {
+	Observe(stats EpochStats)
+}
+
+// StepDecay multiplies the learning rate by Factor every Every epochs
+type StepDecay struct {
+	Every  int
+	Factor mathx.Float
+}
+
+func (s *StepDecay) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	return base * pow(s.Factor, epoch/s.Every)
+}
+
+func (s *StepDecay) String() string {
+	return "step=" + strconv.Itoa(s.Every) + "," + formatFloat(s.Factor)
+}
+
+// ExponentialDecay multiplies the learning rate by Gamma every epoch
+type ExponentialDecay struct {
+	Gamma mathx.Float
+}
+
+func (s *ExponentialDecay) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	return base * pow(s.Gamma, epoch)
+}
+
+func (s *ExponentialDecay) String() string { return "exp=" + formatFloat(s.Gamma) }
+
+func pow(x mathx.Float, n int) mathx.Float {
+	return mathx.Float(math.Pow(float64(x), float64(n)))
+}
+
+// cosine anneals from base to 0 as progress goes from 0 to 1
+func cosine(base mathx.Float, progress float64) mathx.Float {
+	return base * mathx.Float(1+math.Cos(math.Pi*progress)) / 2
+}
+
+// CosineAnnealing anneals the learning rate from the base to 0 along a half
+// cosine over Period epochs and restarts, each period is Mult times longer
+// than the previous one (Loshchilov and Hutter, 2016). The whole run is a
+// single period if Period is 0.
+type CosineAnnealing struct {
+	Period, Mult int
+}
+
+func (s *CosineAnnealing) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	period := s.Period
+	if period <= 0 {
+		period = epochs
+	}
+	for epoch >= period {
+		epoch -= period
+		period *= s.Mult
+	}
+	return cosine(base, float64(epoch)/float64(period))
+}
+
+func (s *CosineAnnealing) String() string {
+	if s.Period <= 0 {
+		return "cosine"
+	}
+	return "cosine=" + strconv.Itoa(s.Period) + "," + strconv.Itoa(s.Mult)
+}
+
+// OneCycle raises the learning rate linearly from base/25 to the base in the
+// first Warmup fraction of epochs and anneals it along a cosine to base/25e4
+// in the rest (Smith, 2018)
+type OneCycle struct {
+	Warmup mathx.Float
+}
+
+func (s *OneCycle) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	const div, finalDiv = 25, 1e4
+	start := base / div
+	end := start / finalDiv
+	up := int(math.Round(float64(s.Warmup) * float64(epochs)))
+	if up < 1 {
+		up = 1
+	}
+	if epoch < up {
+		return start + (base-start)*mathx.Float(epoch)/mathx.Float(up)
+	}
+	down := epochs - 1 - up
+	if down <= 0 {
+		return base
+	}
+	return end + cosine(base-end, float64(epoch-up)/float64(down))
+}
+
+func (s *OneCycle) String() string { return "onecycle=" + formatFloat(s.Warmup) }
+
+// Warmup raises the learning rate linearly to the base in the first Epochs
+// epochs, then Then schedules the rest of the run as if it started after the
+// warmup. The learning rate is constant after the warmup if Then is nil.
+type Warmup struct {
+	Epochs int
+	Then   Scheduler
+}
+
+func (s *Warmup) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	if epoch < s.Epochs {
+		return base * mathx.Float(epoch+1) / mathx.Float(s.Epochs+1)
+	}
+	if s.Then == nil {
+		return base
+	}
+	return s.Then.LearningRate(epoch-s.Epochs, epochs-s.Epochs, base)
+}
+
+// Observe passes stats of epochs after the warmup to Then if it's an Observer
+func (s *Warmup) Observe(stats EpochStats) {
+	if o, ok := s.Then.(Observer); ok && stats.Epoch > s.Epochs {
+		stats.Epoch -= s.Epochs
+		o.Observe(stats)
+	}
+}
+
+func (s *Warmup) String() string {
+	spec := "warmup=" + strconv.Itoa(s.Epochs)
+	if s.Then != nil {
+		spec += "+" + s.Then.String()
+	}
+	return spec
+}
+
+// ReduceOnPlateau multiplies the learning rate by Factor if validation
+// accuracy hasn't improved for Patience epochs
+type ReduceOnPlateau struct {
+	Factor   mathx.Float
+	Patience int
+	// Scale is the product of reductions so far, 0 before the first epoch
+	Scale mathx.Float
+	// Best is the best validation accuracy, Wait is number of epochs since
+	// it improved
+	Best mathx.Float
+	Wait int
+}
+
+func (s *ReduceOnPlateau) LearningRate(epoch, epochs int, base mathx.Float) mathx.Float {
+	return base * s.scale()
+}
+
+func (s *ReduceOnPlateau) scale() mathx.Float {
+	if s.Scale == 0 {
+		return 1
+	}
+	return s.Scale
+}
+
+func (s *ReduceOnPlateau) Observe(stats EpochStats) {
+	if stats.ValidationAccuracy > s.Best {
+		s.Best, s.Wait = stats.ValidationAccuracy, 0
+		return
+	}
+	if s.Wait++; s.Wait >= s.Patience {
+		s.Scale = s.scale() * s.Factor
+		s.Wait = 0
+	}
+}
+
+func (s *ReduceOnPlateau) String() string {
+	return "plateau=" + formatFloat(s.Factor) + "," + strconv.Itoa(s.Patience)
+}
+
+// NeedsValidation returns whether scheduler is driven by validation accuracy,
+// Train requires a validation set for it
+func NeedsValidation(scheduler Scheduler) bool {
+	switch s := scheduler.(type) {
+	case *ReduceOnPlateau:
+		return true
+	case *Warmup:
+		return NeedsValidation(s.Then)
+	}
+	return false
+}
+
+// ParseScheduler parses a learning rate schedule spec: step=every[,factor],
+// exp[=gamma], cosine[=period[,mult]] for cosine annealing with restarts,
+// onecycle[=warmup fraction], plateau[=factor[,patience]] or warmup=epochs
+// optionally followed by + and another schedule, e.g. warmup=2+cosine. nil is
+// returned for an empty spec or constant, i.e. a constant learning rate.
+func ParseScheduler(spec string) (Scheduler, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "constant" {
+		return nil, nil
+	}
+	spec, then, hasThen := strings.Cut(spec, "+")
+	name, arg, hasArg := strings.Cut(spec, "=")
+	var args []float64
+	if hasArg {
+		for _, field := range strings.Split(arg, ",") {
+			x, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule parameter %q", field)
+			}
+			args = append(args, x)
+		}
+	}
+	param := func(i int, def float64) float64 {
+		if i < len(args) {
+			return args[i]
+		}
+		return def
+	}
+	// positive returns the integer parameter i which must be positive
+	positive := func(i int, def float64) (int, error) {
+		x := param(i, def)
+		if x < 1 || x != math.Trunc(x) {
+			return 0, fmt.Errorf("schedule parameter %v of %q must be a positive integer", x, spec)
+		}
+		return int(x), nil
+	}
+	// fraction returns the parameter i which must be in (0, 1)
+	fraction := func(i int, def float64) (mathx.Float, error) {
+		x := param(i, def)
+		if x <= 0 || x >= 1 {
+			return 0, fmt.Errorf("schedule parameter %v of %q out of range (0, 1)", x, spec)
+		}
+		return mathx.Float(x), nil
+	}
+	if hasThen && name != "warmup" {
+		return nil, fmt.Errorf("only warmup can be followed by another schedule: %q", spec)
+	}
+	var (
+		scheduler Scheduler
+		maxArgs   = 2
+		err       error
+	)
+	switch name {
+	case "step":
+		if !hasArg {
+			return nil, fmt.Errorf("step requires number of epochs between decays, e.g. step=3")
+		}
+		s := &StepDecay{}
+		if s.Every, err = positive(0, 0); err == nil {
+			s.Factor, err = fraction(1, 0.5)
+		}
+		scheduler = s
+	case "exp":
+		s := &ExponentialDecay{}
+		s.Gamma, err = fraction(0, 0.9)
+		scheduler, maxArgs = s, 1
+	case "cosine":
+		s := &CosineAnnealing{}
+		if hasArg {
+			if s.Period, err = positive(0, 0); err == nil {
+				s.Mult, err = positive(1, 1)
+			}
+		}
+		scheduler = s
+	case "onecycle":
+		s := &OneCycle{}
+		s.Warmup, err = fraction(0, 0.3)
+		scheduler, maxArgs = s, 1
+	case "plateau":
+		s := &ReduceOnPlateau{}
+		if s.Factor, err = fraction(0, 0.5); err == nil {
+			s.Patience, err = positive(1, 2)
+		}
+		scheduler = s
+	case "warmup":
+		if !hasArg {
+			return nil, fmt.Errorf("warmup requires number of epochs, e.g. warmup=2")
+		}
+		s := &Warmup{}
+		if s.Epochs, err = positive(0, 0); err == nil && hasThen {
+			if strings.TrimSpace(then) == "" {
+				return nil, fmt.Errorf("missing schedule after %q", spec+"+")
+			}
+			s.Then, err = ParseScheduler(then)
+		}
+		scheduler, maxArgs = s, 1
+	default:
+		return nil, fmt.Errorf("unknown learning rate schedule %q", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > maxArgs {
+		return nil, fmt.Errorf("too many parameters of schedule %q", spec)
+	}
+	return scheduler, nil
+}
@@ -0,0 +1,85 @@
+package nn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulers(t *testing.T) {
+	const epochs = 10
+	for spec, want := range map[string][]float64{
+		"step=3":              {1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.25, 0.125},
+		"exp=0.5":             {1, 0.5, 0.25, 0.125, 0.0625, 0.03125, 0.015625, 0.0078125, 0.00390625, 0.001953125},
+		"cosine":              {1, 0.97553, 0.90451, 0.79389, 0.65451, 0.5, 0.34549, 0.20611, 0.09549, 0.02447},
+		"cosine=2,2":          {1, 0.5, 1, 0.85355, 0.5, 0.14645, 1, 0.96194, 0.85355, 0.69134},
+		"onecycle=0.2":        {0.04, 0.52, 1, 0.95048, 0.81174, 0.61126, 0.38874, 0.18826, 0.04952, 0},
+		"warmup=3":            {0.25, 0.5, 0.75, 1, 1, 1, 1, 1, 1, 1},
+		"warmup=1+step=3,0.1": {0.5, 1, 1, 1, 0.1, 0.1, 0.1, 0.01, 0.01, 0.01},
+	} {
+		scheduler, err := ParseScheduler(spec)
+		if !assert.NoError(t, err, spec) {
+			continue
+		}
+		for epoch := 0; epoch < epochs; epoch++ {
+			assert.InDelta(t, want[epoch], float64(scheduler.LearningRate(epoch, epochs, 1)), 1e-4, "%s: epoch %d", spec, epoch)
+		}
+		parsed, err := ParseScheduler(scheduler.String())
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, scheduler, parsed, spec)
+		}
+	}
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := &ReduceOnPlateau{Factor: 0.5, Patience: 2}
+	var lrs []float64
+	for i, accuracy := range []mathx.Float{0.5, 0.6, 0.6, 0.55, 0.7, 0.6, 0.6, 0.6, 0.6} {
+		lrs = append(lrs, float64(s.LearningRate(i, 10, 1)))
+		s.Observe(EpochStats{Epoch: i + 1, ValidationAccuracy: accuracy})
+	}
+	assert.Equal(t, []float64{1, 1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25}, lrs)
+
+	// validation accuracy is observed after the warmup only
+	w := &Warmup{Epochs: 2, Then: &ReduceOnPlateau{Factor: 0.5, Patience: 1}}
+	w.Observe(EpochStats{Epoch: 2, ValidationAccuracy: 0.9})
+	w.Observe(EpochStats{Epoch: 3, ValidationAccuracy: 0.5})
+	assert.Equal(t, mathx.Float(0.5), w.Then.(*ReduceOnPlateau).Best)
+
+	net, err := New([]int{4, 3, 2})
+	if assert.NoError(t, err) {
+		err = net.Train(context.Background(), dataset.NewLoader(stripes(10), 1, 1), TrainOptions{Scheduler: w})
+		assert.Error(t, err, "no validation set")
+	}
+}
+
+func TestParseScheduler(t *testing.T) {
+	for _, spec := range []string{"", "constant"} {
+		scheduler, err := ParseScheduler(spec)
+		assert.NoError(t, err)
+		assert.Nil(t, scheduler)
+	}
+	for _, spec := range []string{"linear", "step", "step=0", "step=2.5", "exp=1", "cosine=2,0", "onecycle=0", "plateau=2", "warmup", "warmup=2+", "step=2+cosine", "warmup=1+lr", "exp=0.5,1"} {
+		_, err := ParseScheduler(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTrainSchedule(t *testing.T) {
+	net, err := New([]int{4, 3, 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var lrs []float64
+	err = net.Train(context.Background(), dataset.NewLoader(stripes(20), 10, 1), TrainOptions{
+		Epochs:       4,
+		LearningRate: 2,
+		Scheduler:    &StepDecay{Every: 2, Factor: 0.5},
+		OnEpoch:      func(s EpochStats) { lrs = append(lrs, float64(s.LearningRate)) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{2, 2, 1, 1}, lrs)
+}
@@ -0,0 +1,240 @@
+package nn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+)
+
+// DefaultEpochs is number of epochs trained if TrainOptions.Epochs is 0
+const DefaultEpochs = 10
+
+// TrainOptions configures Network.Train
+type TrainOptions struct {
+	// Epochs is number of passes over the training set, DefaultEpochs if 0
+	Epochs int
+	// LearningRate is the step size of gradient descent,
+	// DefaultOptimizerLearningRate of the loss and optimizer if 0
+	LearningRate mathx.Float
+	// Scheduler adjusts the learning rate of each epoch, constant if nil.
+	// Schedulers driven by validation accuracy require a validation set.
+	Scheduler Scheduler
+	// Optimizer updates parameters after each mini-batch, plain SGD if nil.
+	// It keeps its state across calls of Train, so a run is resumed by
+	// passing the optimizer of its checkpoint.
+	Optimizer Optimizer
+	// L1 and L2 are regularization strengths, L1*sign(w) + L2*w is added to
+	// the gradient of each weight, biases are not regularized
+	L1, L2 mathx.Float
+	// Validation is evaluated after each epoch if not empty
+	Validation *dataset.Dataset
+	// InitialEpoch is number of epochs which are already trained, training
+	// continues from epoch InitialEpoch+1 to Epochs
+	InitialEpoch int
+	// Seed reseeds the loader by Seed+epoch before each epoch if not 0, so
+	// that batches of an epoch don't depend on previous epochs and a resumed
+	// run sees the same batches as an uninterrupted one
+	Seed int64
+	// OnEpoch is called after each epoch
+	OnEpoch func(EpochStats)
+	// Checkpoint is called after OnEpoch with the number of completed epochs,
+	// training stops if it returns an error
+	Checkpoint func(epoch int) error
+}
+
+// EpochStats reports an epoch of training
+type EpochStats struct {
+	// Epoch is the 1-based index of the epoch
+	Epoch int
+	// LearningRate is the learning rate of the epoch
+	LearningRate mathx.Float
+	// Loss is the mean loss of training samples of the epoch, weighted by
+	// sample weights and without regularization. Parameters change during
+	// the epoch, so it's measured on a moving network.
+	Loss mathx.Float
+	// ValidationLoss and ValidationAccuracy are measured on
+	// TrainOptions.Validation, 0 if the validation set is empty
+	ValidationLoss     mathx.Float
+	ValidationAccuracy mathx.Float
+}
+
+// Train trains the network on batches of loader, the loader must hand out
+// samples, i.e. Loader.Stacked is false. ErrShape is returned if the training
+// or validation set doesn't match the network, or the loader doesn't match
+// its dataset, see dataset.Loader.Check. Training stops early with
+// ctx.Err() if ctx is canceled, parameters are those of the last completed
+// mini-batch.
+func (net *Network) Train(ctx context.Context, loader *dataset.Loader, opts TrainOptions) error {
+	if loader.Stacked {
+		return errors.New("stacked loaders are not supported")
+	}
+	if err := net.checkDataset(loader.Dataset); err != nil {
+		return fmt.Errorf("training set: %w", err)
+	}
+	if err := loader.Check(); errors.Is(err, dataset.ErrShape) {
+		return fmt.Errorf("%w: training set: %v", ErrShape, err)
+	} else if err != nil {
+		return fmt.Errorf("training set: %w", err)
+	}
+	validation := opts.Validation
+	if validation != nil && validation.Len() > 0 {
+		if err := net.checkDataset(validation); err != nil {
+			return fmt.Errorf("validation set: %w", err)
+		}
+	} else if NeedsValidation(opts.Scheduler) {
+		return fmt.Errorf("learning rate schedule %v requires a validation set", opts.Scheduler)
+	}
+	epochs, eta, optimizer := opts.Epochs, opts.LearningRate, opts.Optimizer
+	if epochs <= 0 {
+		epochs = DefaultEpochs
+	}
+	if optimizer == nil {
+		optimizer = &SGD{}
+	}
+	if eta <= 0 {
+		eta = DefaultOptimizerLearningRate(net.loss, optimizer)
+	}
+	for i := opts.InitialEpoch; i < epochs; i++ {
+		if opts.Seed != 0 {
+			loader.Seed(opts.Seed + int64(i))
+		}
+		lr := eta
+		if opts.Scheduler != nil {
+			lr = opts.Scheduler.LearningRate(i, epochs, eta)
+		}
+		var loss mathx.Float
+		count := 0
+		for batch := range loader.Epoch(ctx) {
+			loss += net.updateMiniBatch(batch.Samples, batch.Weights, optimizer, lr, opts.L1, opts.L2)
+			count += batch.Size()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stats := EpochStats{Epoch: i + 1, LearningRate: lr}
+		if count > 0 {
+			stats.Loss = loss / mathx.Float(count)
+		}
+		if validation != nil && validation.Len() > 0 {
+			stats.ValidationAccuracy, stats.ValidationLoss = net.measure(validation, true)
+		}
+		if o, ok := opts.Scheduler.(Observer); ok {
+			o.Observe(stats)
+		}
+		if opts.OnEpoch != nil {
+			opts.OnEpoch(stats)
+		}
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(i + 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateMiniBatch updates parameters by optimizer with gradients of a
+// mini-batch and returns the sum of losses of samples, the loss of each sample
+// is scaled by its weight if weights is not nil
+func (net *Network) updateMiniBatch(dataSet []*dataset.Sample, weights []mathx.Float, optimizer Optimizer, eta, l1, l2 mathx.Float) mathx.Float {
+	n := len(net.weights)
+	nablaWeights := make([]*mathx.Matrix, n)
+	nablaBiases := make([]*mathx.Matrix, n)
+	for i := 0; i < n; i++ {
+		nablaWeights[i] = mathx.NewMatrix(net.weights[i].RowCount(), net.weights[i].ColCount())
+		nablaBiases[i] = mathx.NewMatrix(net.biases[i].RowCount(), 1)
+	}
+	deltaNablaWeights := make([]*mathx.Matrix, n)
+	deltaNablaBiases := make([]*mathx.Matrix, n)
+	for i := 0; i < n; i++ {
+		deltaNablaWeights[i] = mathx.NewMatrix(net.weights[i].RowCount(), net.weights[i].ColCount())
+		deltaNablaBiases[i] = mathx.NewMatrix(net.biases[i].RowCount(), 1)
+	}
+	var loss mathx.Float
+	for k, data := range dataSet {
+		weight := mathx.Float(1)
+		if weights != nil {
+			weight = weights[k]
+		}
+		loss += net.backprop(data, weight, deltaNablaWeights, deltaNablaBiases)
+		for i := range nablaWeights {
+			nablaWeights[i].AddWith(deltaNablaWeights[i])
+			nablaBiases[i].AddWith(deltaNablaBiases[i])
+		}
+	}
+	scale := 1 / mathx.Float(len(dataSet))
+	for i := range net.weights {
+		nablaWeights[i].ScaleWith(scale)
+		nablaBiases[i].ScaleWith(scale)
+		if l1 != 0 || l2 != 0 {
+			nablaWeights[i].AddWith(net.weights[i].Map(func(w mathx.Float) mathx.Float {
+				return l1*sign(w) + l2*w
+			}))
+		}
+	}
+	optimizer.Step(net.params(nablaWeights, nablaBiases), eta)
+	return loss
+}
+
+// params returns weights and biases of layers in order with their gradients,
+// optimizer state is indexed by this order
+func (net *Network) params(nablaWeights, nablaBiases []*mathx.Matrix) []Param {
+	params := make([]Param, 0, 2*len(net.weights))
+	for i := range net.weights {
+		params = append(params,
+			Param{Value: net.weights[i], Grad: nablaWeights[i], Decay: true},
+			Param{Value: net.biases[i], Grad: nablaBiases[i]})
+	}
+	return params
+}
+
+func sign(x mathx.Float) mathx.Float {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// backprop computes gradients of the loss of data scaled by weight and returns
+// the scaled loss
+func (net *Network) backprop(data *dataset.Sample, weight mathx.Float, nablaWeights, nablaBiases []*mathx.Matrix) mathx.Float {
+	n := len(net.weights)
+	for i := 0; i < n; i++ {
+		nablaWeights[i].Reset()
+		nablaBiases[i].Reset()
+	}
+	act := net.preprocessInput(data.Input)
+	acts := []*mathx.Matrix{act}
+	zs := make([]*mathx.Matrix, 0, n)
+	for i := 0; i < n; i++ {
+		z := net.weights[i].Mul(act).AddWith(net.biases[i])
+		zs = append(zs, z)
+		if i+1 < n {
+			act = z.Map(net.activations[i].f)
+			acts = append(acts, act)
+		}
+	}
+
+	loss := net.loss.Value(zs[n-1], data.Label) * weight
+	delta := net.loss.Gradient(zs[n-1], data.Label)
+	if weight != 1 {
+		delta.ScaleWith(weight)
+	}
+
+	nablaWeights[n-1] = delta.Mul(acts[n-1].T())
+	nablaBiases[n-1] = delta.Clone()
+	for i := n - 2; i >= 0; i-- {
+		z := zs[i]
+		sp := z.Map(net.activations[i].df)
+		delta = net.weights[i+1].T().Mul(delta).HadamardProduct(sp)
+		nablaWeights[i] = delta.Mul(acts[i].T())
+		nablaBiases[i] = delta.Clone()
+	}
+	return loss
+}
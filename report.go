@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mkideal/mnist/dataset"
+	"github.com/mkideal/mnist/mathx"
+	"github.com/mkideal/mnist/nn"
+)
+
+// noiseReport reports training accuracy on samples whose label was flipped and
+// on the clean rest. A network robust to label noise predicts the true label
+// of corrupted samples instead of memorizing the noisy one.
+func noiseReport(w io.Writer, net *nn.Network, clean, noisy *dataset.Dataset, flipped []int) error {
+	cleanIndices := make([]int, 0, clean.Len()-len(flipped))
+	for i, k := 0, 0; i < clean.Len(); i++ {
+		if k < len(flipped) && flipped[k] == i {
+			k++
+			continue
+		}
+		cleanIndices = append(cleanIndices, i)
+	}
+	cleanAccuracy, err := net.Evaluate(clean.Subset(cleanIndices))
+	if err != nil {
+		return err
+	}
+	trueAccuracy, err := net.Evaluate(clean.Subset(flipped))
+	if err != nil {
+		return err
+	}
+	noisyAccuracy, err := net.Evaluate(noisy.Subset(flipped))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "label noise: %d of %d training labels flipped", len(flipped), clean.Len())
+	if clean.Len() > 0 {
+		fmt.Fprintf(w, " (%.2f%%)", mathx.Float(len(flipped))/mathx.Float(clean.Len())*100)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "clean samples:     accuracy = %.2f%%\n", cleanAccuracy*100)
+	if len(flipped) > 0 {
+		fmt.Fprintf(w, "corrupted samples: accuracy = %.2f%% on true labels, %.2f%% memorized noisy labels\n", trueAccuracy*100, noisyAccuracy*100)
+	}
+	return nil
+}
+
+// quantizationReport compares accuracy and size of net and its quantized copy
+func quantizationReport(w io.Writer, net *nn.Network, qnet *nn.QuantizedNetwork, testdata *dataset.Dataset) error {
+	floatAccuracy, err := net.Evaluate(testdata)
+	if err != nil {
+		return err
+	}
+	quantAccuracy, err := qnet.Evaluate(testdata)
+	if err != nil {
+		return err
+	}
+	agree := 0
+	for k := 0; k < testdata.Len(); k++ {
+		input := testdata.Input(k)
+		i, _ := net.Predict(input)
+		if j, _ := qnet.Predict(input); i == j {
+			agree++
+		}
+	}
+	fmt.Fprintf(w, "float: accuracy = %.2f%%, size = %d bytes\n", floatAccuracy*100, net.NumParams()*8)
+	fmt.Fprintf(w, "int8:  accuracy = %.2f%%, size = %d bytes\n", quantAccuracy*100, qnet.Size())
+	fmt.Fprintf(w, "diff:  accuracy = %+.2f%%", (quantAccuracy-floatAccuracy)*100)
+	if testdata.Len() > 0 {
+		fmt.Fprintf(w, ", agreement = %.2f%%", mathx.Float(agree)/mathx.Float(testdata.Len())*100)
+	}
+	fmt.Fprintln(w)
+	return nil
+}